@@ -0,0 +1,21 @@
+// Package openapi — спецификация REST API в формате OpenAPI 3.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed openapi.yaml
+var YAML []byte
+
+// JSON возвращает спецификацию в JSON, как её ждут генераторы клиентов.
+func JSON() ([]byte, error) {
+	var spec interface{}
+	if err := yaml.Unmarshal(YAML, &spec); err != nil {
+		return nil, err
+	}
+	return json.Marshal(spec)
+}
@@ -1,107 +1,468 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"github.com/Krchnk/gw-currency-wallet/internal/apidocs"
+	"github.com/Krchnk/gw-currency-wallet/internal/apierror"
 	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"github.com/Krchnk/gw-currency-wallet/internal/cors"
+	"github.com/Krchnk/gw-currency-wallet/internal/credentials"
+	"github.com/Krchnk/gw-currency-wallet/internal/grpcapi"
 	"github.com/Krchnk/gw-currency-wallet/internal/handlers"
+	"github.com/Krchnk/gw-currency-wallet/internal/health"
+	"github.com/Krchnk/gw-currency-wallet/internal/logging"
+	"github.com/Krchnk/gw-currency-wallet/internal/mailer"
+	"github.com/Krchnk/gw-currency-wallet/internal/metrics"
+	"github.com/Krchnk/gw-currency-wallet/internal/outbox"
+	"github.com/Krchnk/gw-currency-wallet/internal/password"
+	"github.com/Krchnk/gw-currency-wallet/internal/ratelimit"
+	"github.com/Krchnk/gw-currency-wallet/internal/requestid"
 	"github.com/Krchnk/gw-currency-wallet/internal/storages/postgres"
+	"github.com/Krchnk/gw-currency-wallet/internal/stream"
+	"github.com/Krchnk/gw-currency-wallet/internal/tlsutil"
+	"github.com/Krchnk/gw-currency-wallet/internal/totp"
+	"github.com/Krchnk/gw-currency-wallet/internal/tracing"
+	"github.com/Krchnk/gw-currency-wallet/internal/webhooks"
+	"io"
 
 	"github.com/Krchnk/currency-wallet-proto/exchangerates"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	grpccredentials "google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 
-	cors "github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"runtime/debug"
+	"sync"
+	"syscall"
 	"time"
 )
 
+// logger — единственный логгер сервиса, он передаётся во все компоненты.
+// До загрузки конфигурации пишет JSON с уровнем info.
 var logger = logrus.New()
 
+// version задаётся при сборке: -ldflags "-X main.version=..."
+var version = "dev"
+
 func init() {
 	logger.SetFormatter(&logrus.JSONFormatter{})
-	if lvl, err := logrus.ParseLevel(os.Getenv("LOG_LEVEL")); err == nil {
-		logger.SetLevel(lvl)
-	} else {
-		logger.SetLevel(logrus.InfoLevel)
-	}
 }
 
 func main() {
 	configPath := flag.String("c", "config.env", "path to config file")
 	flag.Parse()
 
-	cfg, err := config.LoadConfig(*configPath)
+	cfg, err := config.LoadConfig(*configPath, logger)
 	if err != nil {
 		logger.WithError(err).Fatal("failed to load config")
 	}
-	logger.WithField("config", cfg).Info("configuration loaded")
+	if err := logging.Configure(logger, cfg.LoggingConfig); err != nil {
+		logger.WithError(err).Fatal("failed to configure logging")
+	}
+	// Секреты в Config имеют тип config.Secret и выводятся как [REDACTED].
+	logger.WithFields(logrus.Fields{
+		"env":    cfg.Env,
+		"config": cfg,
+	}).Info("configuration loaded")
+
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to initialize tracing")
+	}
+	logger.WithField("exporter", cfg.Tracing.Exporter).Info("tracing initialized")
 
-	store, err := postgres.NewStorage(cfg.DBConfig)
+	store, err := postgres.NewStorage(cfg.DBConfig, cfg.Audit.HMACKey.Value(), logger)
 	if err != nil {
 		logger.WithError(err).Fatal("failed to connect to database")
 	}
 	logger.Info("database connection established")
+	metrics.RegisterDBStats(store.DB())
 
 	// Инициализация gRPC-клиента
-	exchangeRatesServiceAddr := os.Getenv("EXCHANGE_RATES_SERVICE_ADDR")
-	if exchangeRatesServiceAddr == "" {
-		exchangeRatesServiceAddr = "exchange-rates-service:50051" // Значение по умолчанию
-		logger.Warn("EXCHANGE_RATES_SERVICE_ADDR not set, defaulting to exchange-rates-service:50051")
+	transportCreds := insecure.NewCredentials()
+	var clientCerts *tlsutil.CertReloader
+	if cfg.ExchangeRates.TLS.Enabled {
+		tlsConfig, certs, err := tlsutil.ClientConfig(cfg.ExchangeRates.TLS, logger)
+		if err != nil {
+			logger.WithError(err).Fatal("failed to configure TLS for exchange rates gRPC client")
+		}
+		transportCreds = grpccredentials.NewTLS(tlsConfig)
+		clientCerts = certs
 	}
 
-	conn, err := grpc.Dial(exchangeRatesServiceAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(cfg.ExchangeRates.Addr,
+		grpc.WithTransportCredentials(transportCreds),
+		grpc.WithChainUnaryInterceptor(metrics.UnaryClientInterceptor(), requestid.UnaryClientInterceptor()),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	)
 	if err != nil {
 		logger.WithError(err).Fatal("failed to connect to exchange rates gRPC service")
 	}
-	defer conn.Close()
 
 	exchangeRatesClient := exchangerates.NewExchangeRatesServiceClient(conn)
-	logger.WithField("address", exchangeRatesServiceAddr).Info("connected to exchange rates gRPC service")
+	logger.WithField("address", cfg.ExchangeRates.Addr).Info("connected to exchange rates gRPC service")
+
+	// В режиме отладки gin печатает маршруты и предупреждения в stdout мимо logger.
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	// Журнал запросов пишет loggingMiddleware, панику — recoveryHandler:
+	// стандартные логгер и recovery gin пишут мимо logger и без маскирования.
+	router.Use(gin.CustomRecoveryWithWriter(io.Discard, recoveryHandler))
+	router.NoRoute(apierror.NoRoute)
+	router.Use(requestid.Middleware())
 
-	router := gin.Default()
+	router.Use(otelgin.Middleware(cfg.Tracing.ServiceName, otelgin.WithFilter(func(r *http.Request) bool {
+		return r.URL.Path != "/healthz" && r.URL.Path != "/readyz"
+	})))
 
-	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://158.160.136.178", "http://localhost:3000"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
+	// Validate уже проверил, что профиль CORS существует.
+	corsPolicy, _ := cfg.ActiveCORS()
+	corsMiddleware, err := cors.New(corsPolicy)
+	if err != nil {
+		logger.WithError(err).Fatal("invalid CORS policy")
+	}
+	router.Use(corsMiddleware.Handler())
 
 	router.Use(loggingMiddleware())
 
-	h := handlers.NewHandler(store, cfg, exchangeRatesClient)
+	checker, err := health.New(store, conn, cfg.Health.MigrationsDir, version, cfg.Health.CheckTimeout, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to initialize health checks")
+	}
+
+	mail, err := mailer.New(cfg.Mail, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to initialize mailer")
+	}
+	logger.WithField("driver", cfg.Mail.Driver).Info("mailer initialized")
+
+	policy, err := credentials.NewPolicy(cfg.Credentials, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to load credential policy")
+	}
+
+	hasher, err := password.NewHasher(cfg.PasswordHash)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to initialize password hasher")
+	}
+
+	hub := stream.NewHub(logger)
+	h := handlers.NewHandler(store, cfg, exchangeRatesClient, mail, policy, hasher, hub, logger)
+
+	authPolicies := make(map[string]*ratelimit.Limit)
+	for _, route := range config.AuthRoutes {
+		authPolicies[route] = ratelimit.NewLimit(cfg.RateLimit.AuthPolicy(route))
+	}
+	walletPolicy := ratelimit.NewLimit(cfg.RateLimit.Wallet)
+	limitStore := newLimitStore(cfg, store)
+	authLimit, walletLimit := rateLimiters(limitStore, authPolicies, walletPolicy)
+
+	docs, err := apidocs.New(openAPIPath)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to load OpenAPI spec")
+	}
+
+	registerRoutes(router, h, checker, docs, authLimit, walletLimit)
+
+	port := ":" + cfg.HTTP.Port
 
-	api := router.Group("/api/v1")
-	{
-		api.POST("/register", h.Register)
-		api.POST("/login", h.Login)
+	srv := &http.Server{
+		Addr:              port,
+		Handler:           router,
+		ReadTimeout:       cfg.HTTP.ReadTimeout,
+		ReadHeaderTimeout: cfg.HTTP.ReadHeaderTimeout,
+		WriteTimeout:      cfg.HTTP.WriteTimeout,
+		IdleTimeout:       cfg.HTTP.IdleTimeout,
+		MaxHeaderBytes:    cfg.HTTP.MaxHeaderBytes,
+	}
 
-		auth := api.Group("", h.AuthMiddleware())
-		{
-			auth.GET("/balance", h.GetBalance)
-			auth.POST("/wallet/deposit", h.Deposit)
-			auth.POST("/wallet/withdraw", h.Withdraw)
-			auth.GET("/exchange/rates", h.GetRates)
-			auth.POST("/exchange", h.Exchange)
+	var serverCerts *tlsutil.CertReloader
+	if cfg.HTTP.TLS.Enabled() {
+		serverCerts, err = tlsutil.NewCertReloader(cfg.HTTP.TLS.CertFile, cfg.HTTP.TLS.KeyFile, logger)
+		if err != nil {
+			logger.WithError(err).Fatal("failed to load TLS certificate")
+		}
+		srv.TLSConfig, err = tlsutil.ServerConfig(cfg.HTTP.TLS, serverCerts)
+		if err != nil {
+			logger.WithError(err).Fatal("failed to configure TLS")
 		}
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		logger.Warn("PORT not set, defaulting to :8080")
-		port = ":8080"
+	// gRPC API слушает свой порт и использует тот же сертификат, что и HTTP.
+	var grpcCreds grpccredentials.TransportCredentials
+	if srv.TLSConfig != nil {
+		grpcCreds = grpccredentials.NewTLS(srv.TLSConfig)
+	}
+	// Вызовы WalletService расходуют ту же корзину wallet, что и REST.
+	var grpcInterceptors []grpc.UnaryServerInterceptor
+	if limitStore != nil {
+		grpcInterceptors = append(grpcInterceptors, ratelimit.UnaryServerInterceptor(limitStore, "wallet", walletPolicy, grpcapi.RateLimitKey, logger))
+	}
+	grpcServer, grpcHealth := grpcapi.NewServer(h, logger, grpcCreds, cfg.GRPC.Reflection, grpcInterceptors...)
+	grpcListener, err := net.Listen("tcp", ":"+cfg.GRPC.Port)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to listen for gRPC")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Ротация сертификатов подхватывается без перезапуска.
+	if serverCerts != nil {
+		go serverCerts.Watch(ctx, cfg.HTTP.TLS.ReloadInterval)
+	}
+	if clientCerts != nil {
+		go clientCerts.Watch(ctx, cfg.ExchangeRates.TLS.ReloadInterval)
+	}
+
+	reloader := &reloader{
+		path:    *configPath,
+		current: cfg,
+		cors:    corsMiddleware,
+		auth:    authPolicies,
+		wallet:  walletPolicy,
+		handler: h,
+	}
+	go reloader.watch(ctx, cfg.WatchInterval)
+
+	// Фоновые воркеры; shutdown дожидается их перед закрытием базы.
+	var workers sync.WaitGroup
+	if cfg.Webhooks.Enabled {
+		dispatcher := webhooks.NewDispatcher(store, cfg.Webhooks, totp.NewCipher(cfg.EncryptionKey()), logger)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			dispatcher.Run(ctx)
+		}()
+		logger.WithField("poll_interval", cfg.Webhooks.PollInterval).Info("webhook dispatcher started")
+	} else {
+		logger.Warn("webhook delivery disabled on this instance")
+	}
+	if cfg.Outbox.Enabled {
+		publisher, err := outbox.NewPublisher(cfg.Outbox, logger)
+		if err != nil {
+			logger.WithError(err).Fatal("failed to create outbox publisher")
+		}
+		relay := outbox.NewRelay(store, publisher, cfg.Outbox, logger)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			relay.Run(ctx)
+			if err := publisher.Close(); err != nil {
+				logger.WithError(err).Error("failed to close outbox publisher")
+			}
+		}()
+		logger.WithField("broker", cfg.Outbox.Broker).Info("outbox relay started")
 	} else {
-		port = ":" + port
+		logger.Warn("outbox relay disabled on this instance")
+	}
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		hub.Run(ctx, store)
+	}()
+	if cleaner, ok := limitStore.(ratelimit.Cleaner); ok {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			ratelimit.RunCleanup(ctx, cleaner, logger)
+		}()
 	}
+	// Потоки /wallet/stream не завершаются сами; без этого Shutdown ждал бы их до таймаута.
+	srv.RegisterOnShutdown(hub.Close)
 
-	logger.WithField("port", port).Info("starting HTTP server")
-	if err := router.Run(port); err != nil {
-		logger.WithError(err).Fatal("failed to run server")
+	serverErr := make(chan error, 3)
+	go func() {
+		logger.WithFields(logrus.Fields{
+			"port": port,
+			"tls":  serverCerts != nil,
+		}).Info("starting HTTP server")
+
+		var err error
+		if serverCerts != nil {
+			// Сертификат отдаёт TLSConfig.GetCertificate, поэтому пути не нужны.
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	metricsSrv := newMetricsServer(cfg.Metrics.Addr)
+	if metricsSrv != nil {
+		go func() {
+			logger.WithField("addr", cfg.Metrics.Addr).Info("starting metrics server")
+			if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- err
+			}
+		}()
+	} else {
+		logger.Warn("metrics server disabled")
+	}
+
+	go func() {
+		logger.WithFields(logrus.Fields{
+			"port":       cfg.GRPC.Port,
+			"tls":        grpcCreds != nil,
+			"reflection": cfg.GRPC.Reflection,
+		}).Info("starting gRPC server")
+
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			serverErr <- err
+		}
+	}()
+
+	failed := false
+	select {
+	case <-ctx.Done():
+		logger.Info("shutdown signal received, draining connections")
+	case err := <-serverErr:
+		logger.WithError(err).Error("failed to run server")
+		failed = true
 	}
+	// Повторный сигнал завершает процесс сразу, не дожидаясь запросов.
+	stop()
+	// Балансировщики по gRPC health check перестают слать новые вызовы.
+	grpcHealth.Shutdown()
+
+	if !shutdown(cfg.HTTP.ShutdownTimeout, srv, metricsSrv, grpcServer, &workers, conn, store, shutdownTracing) || failed {
+		os.Exit(1)
+	}
+	logger.Info("server stopped")
+}
+
+// shutdown останавливает сервис по порядку: HTTP- и gRPC-серверы перестают
+// принимать соединения и дожидаются текущих запросов, фоновые воркеры
+// (уже получившие отмену контекста) завершают начатую работу, затем
+// закрываются gRPC-клиент, пул соединений с базой и экспортёр трассировок.
+// На всё отводится timeout.
+func shutdown(timeout time.Duration, srv, metricsSrv *http.Server, grpcServer *grpc.Server, workers *sync.WaitGroup, conn *grpc.ClientConn, store *postgres.Storage, shutdownTracing tracing.Shutdown) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	grpcStopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcStopped)
+	}()
+
+	ok := true
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.WithError(err).Error("failed to drain HTTP connections in time, closing them")
+		srv.Close()
+		ok = false
+	}
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(ctx); err != nil {
+			metricsSrv.Close()
+		}
+	}
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		logger.Error("failed to drain gRPC connections in time, closing them")
+		grpcServer.Stop()
+		ok = false
+	}
+
+	workersStopped := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(workersStopped)
+	}()
+	select {
+	case <-workersStopped:
+	case <-ctx.Done():
+		logger.Error("background workers did not stop in time")
+		ok = false
+	}
+	if err := conn.Close(); err != nil {
+		logger.WithError(err).Error("failed to close exchange rates gRPC connection")
+		ok = false
+	}
+	if err := store.Close(); err != nil {
+		logger.WithError(err).Error("failed to close database connection")
+		ok = false
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		logger.WithError(err).Error("failed to flush traces")
+		ok = false
+	}
+	return ok
+}
+
+// newMetricsServer создаёт листенер /metrics на addr, отдельный от API.
+// Пустой addr — метрики выключены, возвращается nil.
+func newMetricsServer(addr string) *http.Server {
+	if addr == "" {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	return &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+}
+
+// newLimitStore выбирает хранилище лимитов; nil — лимиты выключены.
+func newLimitStore(cfg config.Config, store *postgres.Storage) ratelimit.Store {
+	if !cfg.RateLimit.Enabled {
+		logger.Warn("rate limiting disabled")
+		return nil
+	}
+
+	var limitStore ratelimit.Store
+	switch cfg.RateLimit.Backend {
+	case "postgres":
+		limitStore = postgres.NewRateLimitStore(store)
+	case "memory":
+		limitStore = ratelimit.NewMemoryStore()
+	default:
+		logger.WithField("backend", cfg.RateLimit.Backend).Warn("unknown rate limit backend, defaulting to memory")
+		limitStore = ratelimit.NewMemoryStore()
+	}
+	logger.WithField("backend", cfg.RateLimit.Backend).Info("rate limiting enabled")
+	return limitStore
+}
+
+// rateLimiters собирает middleware лимитов: для маршрутов без аутентификации
+// ключом служит IP и у каждого маршрута своя корзина, для остальных
+// маршрутов — user_id из JWT.
+func rateLimiters(limitStore ratelimit.Store, auth map[string]*ratelimit.Limit, wallet *ratelimit.Limit) (func(route string) gin.HandlerFunc, gin.HandlerFunc) {
+	if limitStore == nil {
+		noop := func(c *gin.Context) { c.Next() }
+		return func(string) gin.HandlerFunc { return noop }, noop
+	}
+	authLimit := func(route string) gin.HandlerFunc {
+		return ratelimit.Middleware(limitStore, "auth:"+route, auth[route], ratelimit.KeyByIP, logger)
+	}
+	return authLimit, ratelimit.Middleware(limitStore, "wallet", wallet, ratelimit.KeyByUser, logger)
+}
+
+// recoveryHandler записывает панику в обработчике со стеком и отвечает 500.
+func recoveryHandler(c *gin.Context, recovered interface{}) {
+	logger.WithContext(c.Request.Context()).WithFields(logrus.Fields{
+		"method": c.Request.Method,
+		"path":   c.Request.URL.Path,
+		"panic":  fmt.Sprint(recovered),
+		"stack":  string(debug.Stack()),
+	}).Error("panic recovered")
+	apierror.Recovery(c, recovered)
 }
 
 func loggingMiddleware() gin.HandlerFunc {
@@ -109,7 +470,7 @@ func loggingMiddleware() gin.HandlerFunc {
 		start := time.Now()
 		path := c.Request.URL.Path
 
-		logger.WithFields(logrus.Fields{
+		logger.WithContext(c.Request.Context()).WithFields(logrus.Fields{
 			"method": c.Request.Method,
 			"path":   path,
 		}).Info("request received")
@@ -117,17 +478,29 @@ func loggingMiddleware() gin.HandlerFunc {
 		c.Next()
 
 		duration := time.Since(start)
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.ObserveHTTPRequest(c.Request.Method, route, c.Writer.Status(), duration)
+
 		fields := logrus.Fields{
 			"method":   c.Request.Method,
 			"path":     path,
 			"status":   c.Writer.Status(),
 			"duration": duration,
 		}
-
+		// user_id и api_key_id добавляет AuthMiddleware через контекст запроса.
 		if len(c.Errors) > 0 {
-			logger.WithFields(fields).WithError(c.Errors.Last()).Error("request failed")
+			err := c.Errors.Last().Err
+			var problem *apierror.Problem
+			if errors.As(err, &problem) {
+				fields["error_code"] = problem.Code
+			}
+			logger.WithContext(c.Request.Context()).WithFields(fields).WithError(err).Error("request failed")
 		} else {
-			logger.WithFields(fields).Info("request completed")
+			logger.WithContext(c.Request.Context()).WithFields(fields).Info("request completed")
 		}
 	}
 }
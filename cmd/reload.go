@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"github.com/Krchnk/gw-currency-wallet/internal/cors"
+	"github.com/Krchnk/gw-currency-wallet/internal/handlers"
+	"github.com/Krchnk/gw-currency-wallet/internal/logging"
+	"github.com/Krchnk/gw-currency-wallet/internal/ratelimit"
+)
+
+// reloader перечитывает конфигурацию по SIGHUP или при изменении файла и
+// применяет настройки, которые можно менять без перезапуска: уровень,
+// формат и маскирование журнала, CORS, лимиты запросов, TTL кэша курсов и
+// настройки Handler, в том числе комиссии и флаги функций.
+type reloader struct {
+	path    string
+	current config.Config
+	cors    *cors.Middleware
+	auth    map[string]*ratelimit.Limit // по маршрутам config.AuthRoutes
+	wallet  *ratelimit.Limit
+	handler *handlers.Handler
+}
+
+func (r *reloader) watch(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	// Без опроса файла канал таймера остаётся nil и select его не выбирает.
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	sum := fileSum(r.path)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			logger.Info("SIGHUP received, reloading config")
+			sum = fileSum(r.path)
+			r.reload()
+		case <-tick:
+			if next := fileSum(r.path); next != sum {
+				sum = next
+				logger.WithField("path", r.path).Info("config file changed, reloading")
+				r.reload()
+			}
+		}
+	}
+}
+
+func (r *reloader) reload() {
+	cfg, err := config.LoadConfig(r.path, logger)
+	if err != nil {
+		logger.WithError(err).Error("failed to reload config, keeping current settings")
+		return
+	}
+
+	// Validate уже проверил, что профиль CORS существует.
+	corsPolicy, _ := cfg.ActiveCORS()
+	if err := r.cors.Update(corsPolicy); err != nil {
+		logger.WithError(err).Error("invalid CORS policy, keeping current settings")
+		return
+	}
+	if err := logging.Configure(logger, cfg.LoggingConfig); err != nil {
+		logger.WithError(err).Error("invalid logging settings, keeping current ones")
+	}
+	for route, limit := range r.auth {
+		limit.Set(cfg.RateLimit.AuthPolicy(route))
+	}
+	r.wallet.Set(cfg.RateLimit.Wallet)
+	r.handler.Reload(cfg)
+
+	if changed := restartRequired(r.current, cfg); len(changed) > 0 {
+		logger.WithField("settings", changed).Warn("changed settings take effect only after restart")
+	}
+	r.current = cfg
+	logger.Info("config reloaded")
+}
+
+// restartRequired перечисляет изменённые настройки, которые применяются
+// только при запуске.
+func restartRequired(old, cfg config.Config) []string {
+	structural := []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"env", old.Env, cfg.Env},
+		{"jwt_secret", old.JWTSecret, cfg.JWTSecret},
+		{"db", old.DBConfig, cfg.DBConfig},
+		{"http", old.HTTP, cfg.HTTP},
+		{"grpc", old.GRPC, cfg.GRPC},
+		{"exchange_rates.addr", old.ExchangeRates.Addr, cfg.ExchangeRates.Addr},
+		{"rate_limit.enabled", old.RateLimit.Enabled, cfg.RateLimit.Enabled},
+		{"rate_limit.backend", old.RateLimit.Backend, cfg.RateLimit.Backend},
+		{"totp.issuer", old.TOTP.Issuer, cfg.TOTP.Issuer},
+		{"totp.encryption_key", old.TOTP.EncryptionKey, cfg.TOTP.EncryptionKey},
+		{"audit.hmac_key", old.Audit.HMACKey, cfg.Audit.HMACKey},
+		{"mail", old.Mail, cfg.Mail},
+		{"credentials", old.Credentials, cfg.Credentials},
+		{"password_hash", old.PasswordHash, cfg.PasswordHash},
+		{"tracing", old.Tracing, cfg.Tracing},
+		{"health", old.Health, cfg.Health},
+		{"metrics", old.Metrics, cfg.Metrics},
+		{"webhooks", old.Webhooks, cfg.Webhooks},
+		{"outbox", old.Outbox, cfg.Outbox},
+		{"watch_interval", old.WatchInterval, cfg.WatchInterval},
+	}
+
+	var changed []string
+	for _, s := range structural {
+		if !reflect.DeepEqual(s.old, s.new) {
+			changed = append(changed, s.name)
+		}
+	}
+	return changed
+}
+
+// fileSum возвращает хэш содержимого файла. Сравнение по содержимому, а не
+// по времени изменения, замечает и подмену файла через symlink.
+func fileSum(path string) [sha256.Size]byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}
+	}
+	return sha256.Sum256(data)
+}
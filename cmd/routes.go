@@ -0,0 +1,78 @@
+package main
+
+import (
+	"github.com/Krchnk/gw-currency-wallet/internal/apidocs"
+	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"github.com/Krchnk/gw-currency-wallet/internal/handlers"
+	"github.com/Krchnk/gw-currency-wallet/internal/health"
+	"github.com/gin-gonic/gin"
+)
+
+const openAPIPath = "/api/v1/openapi.json"
+
+// registerRoutes регистрирует все маршруты сервиса. Каждый из них должен
+// быть описан в api/openapi/openapi.yaml, это проверяет routes_test.go.
+func registerRoutes(router *gin.Engine, h *handlers.Handler, checker *health.Checker, docs *apidocs.Docs, authLimit func(route string) gin.HandlerFunc, walletLimit gin.HandlerFunc) {
+	router.GET("/healthz", checker.Healthz)
+	router.GET("/readyz", checker.Readyz)
+
+	api := router.Group("/api/v1")
+	{
+		api.GET("/openapi.json", docs.Spec)
+		api.GET("/docs/*filepath", docs.UI)
+
+		api.POST("/register", authLimit(config.RouteRegister), h.Register)
+		api.POST("/login", authLimit(config.RouteLogin), h.Login)
+		api.POST("/login/2fa", authLimit(config.RouteLoginTOTP), h.LoginTOTP)
+
+		api.POST("/auth/verify-email", authLimit(config.RouteVerifyEmail), h.VerifyEmail)
+		api.POST("/auth/verify-email/resend", authLimit(config.RouteResendVerification), h.ResendVerification)
+		api.POST("/auth/password/forgot", authLimit(config.RouteForgotPassword), h.ForgotPassword)
+		api.POST("/auth/password/reset", authLimit(config.RouteResetPassword), h.ResetPassword)
+
+		auth := api.Group("", h.AuthMiddleware(), walletLimit)
+		{
+			auth.GET("/balance", h.RequireScope(handlers.ScopeReadBalance), h.GetBalance)
+			auth.POST("/wallet/deposit", h.RequireScope(handlers.ScopeWriteDeposit), h.Deposit)
+			auth.POST("/wallet/withdraw", h.RequireScope(handlers.ScopeWriteWithdraw), h.Withdraw)
+			auth.GET("/wallet/transactions", h.RequireScope(handlers.ScopeReadBalance), h.GetTransactions)
+			auth.GET("/wallet/stream", h.RequireScope(handlers.ScopeReadBalance), h.WalletStream)
+			auth.GET("/exchange/rates", h.RequireScope(handlers.ScopeReadRates), h.GetRates)
+			auth.POST("/exchange", h.RequireScope(handlers.ScopeWriteExchange), h.Exchange)
+
+			auth.POST("/webhooks", h.RequireScope(handlers.ScopeWriteWebhooks), h.CreateWebhook)
+			auth.GET("/webhooks", h.RequireScope(handlers.ScopeReadWebhooks), h.ListWebhooks)
+			auth.DELETE("/webhooks/:id", h.RequireScope(handlers.ScopeWriteWebhooks), h.DeleteWebhook)
+			auth.GET("/webhooks/:id/deliveries", h.RequireScope(handlers.ScopeReadWebhooks), h.ListWebhookDeliveries)
+			auth.POST("/webhooks/:id/deliveries/:delivery_id/replay", h.RequireScope(handlers.ScopeWriteWebhooks), h.ReplayWebhookDelivery)
+			auth.POST("/webhooks/:id/replay", h.RequireScope(handlers.ScopeWriteWebhooks), h.ReplayDeadWebhookDeliveries)
+		}
+
+		// Управление учётной записью доступно только по JWT, не по API-ключу.
+		user := auth.Group("", h.RequireJWT())
+		{
+			user.POST("/2fa/enroll", h.EnrollTOTP)
+			user.POST("/2fa/confirm", h.ConfirmTOTP)
+			user.POST("/2fa/disable", h.DisableTOTP)
+
+			user.POST("/auth/refresh", h.RefreshToken)
+			user.POST("/me/password", h.ChangePassword)
+			user.GET("/me/sessions", h.ListSessions)
+			user.DELETE("/me/sessions", h.RevokeOtherSessions)
+			user.DELETE("/me/sessions/:id", h.RevokeSession)
+
+			user.POST("/api-keys", h.CreateAPIKey)
+			user.GET("/api-keys", h.ListAPIKeys)
+			user.DELETE("/api-keys/:id", h.RevokeAPIKey)
+
+			user.GET("/me/audit-log", h.GetMyAuditLog)
+		}
+
+		admin := auth.Group("/admin", h.RequireAdmin())
+		{
+			admin.GET("/audit-log", h.AdminListAuditLog)
+			admin.GET("/audit-log/verify", h.AdminVerifyAuditLog)
+			admin.GET("/status", checker.Status)
+		}
+	}
+}
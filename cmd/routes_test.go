@@ -0,0 +1,70 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Krchnk/gw-currency-wallet/api/openapi"
+	"github.com/Krchnk/gw-currency-wallet/internal/apidocs"
+	"github.com/Krchnk/gw-currency-wallet/internal/handlers"
+	"github.com/Krchnk/gw-currency-wallet/internal/health"
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// Маршруты, которые не описываются в спецификации: статика Swagger UI.
+var undocumentedRoutes = map[string]bool{
+	"GET /api/v1/docs/*filepath": true,
+}
+
+var pathParam = regexp.MustCompile(`:(\w+)`)
+
+var httpMethods = map[string]bool{
+	"get": true, "put": true, "post": true, "delete": true,
+	"options": true, "head": true, "patch": true, "trace": true,
+}
+
+func TestRoutesDocumented(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	docs, err := apidocs.New(openAPIPath)
+	if err != nil {
+		t.Fatalf("load docs: %v", err)
+	}
+	router := gin.New()
+	noop := func(c *gin.Context) { c.Next() }
+	authLimit := func(string) gin.HandlerFunc { return noop }
+	registerRoutes(router, &handlers.Handler{}, &health.Checker{}, docs, authLimit, noop)
+
+	var spec struct {
+		Paths map[string]map[string]interface{} `yaml:"paths"`
+	}
+	if err := yaml.Unmarshal(openapi.YAML, &spec); err != nil {
+		t.Fatalf("parse openapi.yaml: %v", err)
+	}
+
+	registered := make(map[string]bool)
+	for _, route := range router.Routes() {
+		key := route.Method + " " + route.Path
+		if undocumentedRoutes[key] {
+			continue
+		}
+		path := pathParam.ReplaceAllString(route.Path, "{$1}")
+		registered[route.Method+" "+path] = true
+		if _, ok := spec.Paths[path][strings.ToLower(route.Method)]; !ok {
+			t.Errorf("route %s is not described in api/openapi/openapi.yaml", key)
+		}
+	}
+
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			if !httpMethods[method] {
+				continue
+			}
+			if key := strings.ToUpper(method) + " " + path; !registered[key] {
+				t.Errorf("openapi.yaml describes %s, but no such route is registered", key)
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package apidocs
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Krchnk/gw-currency-wallet/api/openapi"
+	"github.com/gin-gonic/gin"
+	swaggerfiles "github.com/swaggo/files/v2"
+)
+
+// Docs отдаёт спецификацию OpenAPI и Swagger UI, встроенные в бинарник.
+type Docs struct {
+	spec        []byte
+	initializer string
+}
+
+// New готовит JSON-версию спецификации; specURL — путь, по которому
+// Swagger UI будет её запрашивать.
+func New(specURL string) (*Docs, error) {
+	spec, err := openapi.JSON()
+	if err != nil {
+		return nil, fmt.Errorf("parse openapi spec: %w", err)
+	}
+	return &Docs{
+		spec:        spec,
+		initializer: fmt.Sprintf(initializerTemplate, strconv.Quote(specURL)),
+	}, nil
+}
+
+func (d *Docs) Spec(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", d.spec)
+}
+
+// UI отдаёт файлы Swagger UI. Маршрут должен заканчиваться на /*filepath.
+func (d *Docs) UI(c *gin.Context) {
+	path := c.Param("filepath")
+	if path == "/swagger-initializer.js" {
+		c.Data(http.StatusOK, "application/javascript", []byte(d.initializer))
+		return
+	}
+	c.FileFromFS(path, http.FS(swaggerfiles.FS))
+}
+
+// initializerTemplate заменяет swagger-initializer.js из дистрибутива,
+// который указывает на демонстрационную спецификацию petstore.
+const initializerTemplate = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: %s,
+    dom_id: '#swagger-ui',
+    deepLinking: true,
+    presets: [
+      SwaggerUIBundle.presets.apis,
+      SwaggerUIStandalonePreset
+    ],
+    plugins: [
+      SwaggerUIBundle.plugins.DownloadUrl
+    ],
+    layout: "StandaloneLayout"
+  });
+};
+`
@@ -0,0 +1,132 @@
+package apierror
+
+import (
+	"net/http"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/requestid"
+	"github.com/Krchnk/gw-currency-wallet/internal/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// ContentType — тип ответа с ошибкой по RFC 7807.
+const ContentType = "application/problem+json"
+
+// Коды ошибок. Клиенты опираются на них, а не на текст, поэтому
+// существующие коды не переименовываются.
+const (
+	CodeInvalidRequest    = "invalid_request"
+	CodeValidationFailed  = "validation_failed"
+	CodeUnauthorized      = "unauthorized"
+	CodeForbidden         = "forbidden"
+	CodeInsufficientScope = "insufficient_scope"
+	CodeUserAuthRequired  = "user_authentication_required"
+	CodeNotFound          = "not_found"
+	CodeRateLimited       = "rate_limited"
+	CodeInternal          = "internal_error"
+	CodeRatesUnavailable  = "rates_unavailable"
+
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeEmailNotVerified   = "email_not_verified"
+	CodeAlreadyExists      = "already_exists"
+	CodeTokenInvalid       = "token_invalid"
+	CodeMFATokenInvalid    = "mfa_token_invalid"
+	CodeSecondFactorFailed = "second_factor_invalid"
+	CodeTOTPNotEnrolled    = "totp_not_enrolled"
+	CodeTOTPAlreadyEnabled = "totp_already_enabled"
+	CodeInvalidTOTPCode    = "invalid_totp_code"
+	CodeStepUpRequired     = "step_up_required"
+
+	CodeInvalidAmount     = "invalid_amount"
+	CodeInsufficientFunds = "insufficient_funds"
+	CodeFeatureDisabled   = "feature_disabled"
+
+	CodeWebhookLimitReached = "webhook_limit_reached"
+)
+
+// Problem — тело ответа с ошибкой. Поля type, title, status и detail взяты
+// из RFC 7807, остальные — его расширения.
+type Problem struct {
+	Type      string                  `json:"type"`
+	Title     string                  `json:"title"`
+	Status    int                     `json:"status"`
+	Code      string                  `json:"code"`
+	Detail    string                  `json:"detail"`
+	Instance  string                  `json:"instance,omitempty"`
+	RequestID string                  `json:"request_id,omitempty"`
+	Errors    []validation.FieldError `json:"errors,omitempty"`
+
+	cause error
+}
+
+// New создаёт ошибку с кодом и сообщением для человека.
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+// Validation — ошибка 400 со списком полей.
+func Validation(fields []validation.FieldError) *Problem {
+	p := New(http.StatusBadRequest, CodeValidationFailed, "Validation failed")
+	p.Errors = fields
+	return p
+}
+
+// Internal — ошибка 500. Причина попадает в журнал, но не в ответ.
+func Internal(cause error) *Problem {
+	return New(http.StatusInternalServerError, CodeInternal, "Internal server error").WithCause(cause)
+}
+
+// WithCause запоминает исходную ошибку для журнала запросов.
+func (p *Problem) WithCause(err error) *Problem {
+	p.cause = err
+	return p
+}
+
+func (p *Problem) Error() string {
+	msg := p.Code + ": " + p.Detail
+	if p.cause != nil {
+		msg += ": " + p.cause.Error()
+	}
+	return msg
+}
+
+func (p *Problem) Unwrap() error {
+	return p.cause
+}
+
+// Abort отвечает ошибкой, записывает её в c.Errors, откуда её берёт журнал
+// запросов, и прерывает цепочку обработчиков.
+func Abort(c *gin.Context, p *Problem) {
+	p.Instance = c.Request.URL.Path
+	p.RequestID = requestID(c)
+
+	_ = c.Error(p)
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+// Respond — сокращение для Abort(c, New(status, code, detail)).
+func Respond(c *gin.Context, status int, code, detail string) {
+	Abort(c, New(status, code, detail))
+}
+
+// NoRoute отвечает в том же формате на неизвестные маршруты.
+func NoRoute(c *gin.Context) {
+	Respond(c, http.StatusNotFound, CodeNotFound, "Route not found")
+}
+
+// Recovery отвечает 500 на панику в обработчике; записать панику в журнал —
+// дело вызывающего.
+func Recovery(c *gin.Context, recovered interface{}) {
+	Abort(c, New(http.StatusInternalServerError, CodeInternal, "Internal server error"))
+}
+
+// requestID связывает ответ с записями журнала по X-Request-ID.
+func requestID(c *gin.Context) string {
+	return requestid.FromContext(c.Request.Context())
+}
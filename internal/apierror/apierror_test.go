@@ -0,0 +1,137 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/requestid"
+	"github.com/Krchnk/gw-currency-wallet/internal/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// serve выполняет запрос через роутер с единственным обработчиком h и
+// возвращает ответ вместе с тем, что обработчик оставил в c.Errors.
+func serve(t *testing.T, h gin.HandlerFunc) (*httptest.ResponseRecorder, []*gin.Error) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	var errs []*gin.Error
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		ctx := requestid.NewContext(c.Request.Context(), "req-1")
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+		errs = c.Errors
+	})
+	r.GET("/wallet", h, func(c *gin.Context) {
+		t.Error("handler chain was not aborted")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/wallet", nil))
+	return w, errs
+}
+
+func decode(t *testing.T, w *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	if got := w.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, ContentType)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode body %s: %v", w.Body.String(), err)
+	}
+	return body
+}
+
+func TestRespond(t *testing.T) {
+	w, errs := serve(t, func(c *gin.Context) {
+		Respond(c, http.StatusConflict, CodeAlreadyExists, "Username or email already exists")
+	})
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusConflict)
+	}
+	want := map[string]interface{}{
+		"type":       "about:blank",
+		"title":      "Conflict",
+		"status":     float64(http.StatusConflict),
+		"code":       CodeAlreadyExists,
+		"detail":     "Username or email already exists",
+		"instance":   "/wallet",
+		"request_id": "req-1",
+	}
+	if got := decode(t, w); !reflect.DeepEqual(got, want) {
+		t.Errorf("body = %v, want %v", got, want)
+	}
+	if len(errs) != 1 {
+		t.Fatalf("c.Errors has %d entries, want 1", len(errs))
+	}
+}
+
+func TestInternalHidesCause(t *testing.T) {
+	cause := errors.New("pq: connection refused")
+	w, errs := serve(t, func(c *gin.Context) {
+		Abort(c, Internal(cause))
+	})
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	body := decode(t, w)
+	if body["code"] != CodeInternal || body["detail"] != "Internal server error" {
+		t.Errorf("body = %v, want code %s with a generic detail", body, CodeInternal)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0].Err, cause) {
+		t.Errorf("c.Errors = %v, want the cause for the request log", errs)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	fields := []validation.FieldError{
+		{Field: "amount", Message: "is required"},
+		{Field: "currency", Message: "must be one of USD, RUB, EUR"},
+	}
+	w, _ := serve(t, func(c *gin.Context) {
+		Abort(c, Validation(fields))
+	})
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	body := decode(t, w)
+	if body["code"] != CodeValidationFailed {
+		t.Errorf("code = %v, want %s", body["code"], CodeValidationFailed)
+	}
+	want := []interface{}{
+		map[string]interface{}{"field": "amount", "message": "is required"},
+		map[string]interface{}{"field": "currency", "message": "must be one of USD, RUB, EUR"},
+	}
+	if !reflect.DeepEqual(body["errors"], want) {
+		t.Errorf("errors = %v, want %v", body["errors"], want)
+	}
+}
+
+func TestNoRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.NoRoute(NoRoute)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	body := decode(t, w)
+	if body["code"] != CodeNotFound || body["instance"] != "/missing" {
+		t.Errorf("body = %v, want code %s for /missing", body, CodeNotFound)
+	}
+	if _, ok := body["request_id"]; ok {
+		t.Errorf("request_id present without a request ID in context")
+	}
+}
@@ -1,33 +1,380 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
 	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
-	"os"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
 )
 
 type Config struct {
-	//HTTPPort  string
-	DBConfig  DBConfig
-	JWTSecret string
+	// development или production. В production сервис не стартует с
+	// секретами по умолчанию.
+	Env           string `yaml:"env" toml:"env"`
+	LoggingConfig `yaml:",inline"`
+	// Как часто проверять, не изменился ли файл конфигурации. 0 — только по SIGHUP.
+	WatchInterval time.Duration       `yaml:"watch_interval" toml:"watch_interval"`
+	DBConfig      DBConfig            `yaml:"db" toml:"db"`
+	JWTSecret     Secret              `yaml:"jwt_secret" toml:"jwt_secret"`
+	HTTP          HTTPConfig          `yaml:"http" toml:"http"`
+	GRPC          GRPCConfig          `yaml:"grpc" toml:"grpc"`
+	CORS          CORSConfig          `yaml:"cors" toml:"cors"`
+	ExchangeRates ExchangeRatesConfig `yaml:"exchange_rates" toml:"exchange_rates"`
+	RateLimit     RateLimitConfig     `yaml:"rate_limit" toml:"rate_limit"`
+	TOTP          TOTPConfig          `yaml:"totp" toml:"totp"`
+	Audit         AuditConfig         `yaml:"audit" toml:"audit"`
+	Mail          MailConfig          `yaml:"mail" toml:"mail"`
+	Account       AccountConfig       `yaml:"account" toml:"account"`
+	Fees          FeesConfig          `yaml:"fees" toml:"fees"`
+	Features      FeaturesConfig      `yaml:"features" toml:"features"`
+	Credentials   CredentialsConfig   `yaml:"credentials" toml:"credentials"`
+	PasswordHash  PasswordHashConfig  `yaml:"password_hash" toml:"password_hash"`
+	Tracing       TracingConfig       `yaml:"tracing" toml:"tracing"`
+	Health        HealthConfig        `yaml:"health" toml:"health"`
+	Metrics       MetricsConfig       `yaml:"metrics" toml:"metrics"`
+	Webhooks      WebhooksConfig      `yaml:"webhooks" toml:"webhooks"`
+	Outbox        OutboxConfig        `yaml:"outbox" toml:"outbox"`
+}
+
+// LoggingConfig — журнал сервиса. Поля лежат на верхнем уровне конфигурации
+// рядом с log_level.
+type LoggingConfig struct {
+	LogLevel string `yaml:"log_level" toml:"log_level"`
+	// json или text
+	LogFormat string `yaml:"log_format" toml:"log_format"`
+	// Что маскировать в журнале: email, amount, token, username
+	LogRedact []string `yaml:"log_redact" toml:"log_redact"`
+}
+
+type HTTPConfig struct {
+	Port              string        `yaml:"port" toml:"port"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" toml:"max_header_bytes"`
+	// Сколько ждать завершения текущих запросов после SIGTERM
+	ShutdownTimeout time.Duration   `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	TLS             ServerTLSConfig `yaml:"tls" toml:"tls"`
+}
+
+// GRPCConfig — gRPC API кошелька. TLS берётся из http.tls: если там задан
+// сертификат, gRPC тоже принимает только TLS-соединения.
+type GRPCConfig struct {
+	Port string `yaml:"port" toml:"port"`
+	// Reflection позволяет grpcurl и подобным клиентам получать схему с сервера
+	Reflection bool `yaml:"reflection" toml:"reflection"`
+}
+
+// ServerTLSConfig включает HTTPS, если заданы CertFile и KeyFile. Файлы
+// перечитываются при изменении раз в ReloadInterval.
+type ServerTLSConfig struct {
+	CertFile       string        `yaml:"cert_file" toml:"cert_file"`
+	KeyFile        string        `yaml:"key_file" toml:"key_file"`
+	MinVersion     string        `yaml:"min_version" toml:"min_version"` // 1.2 или 1.3
+	ReloadInterval time.Duration `yaml:"reload_interval" toml:"reload_interval"`
+}
+
+func (t ServerTLSConfig) Enabled() bool {
+	return t.CertFile != ""
+}
+
+// ClientTLSConfig — TLS для исходящих gRPC-соединений. CertFile и KeyFile
+// включают mTLS; клиентский сертификат перечитывается раз в ReloadInterval.
+type ClientTLSConfig struct {
+	Enabled        bool          `yaml:"enabled" toml:"enabled"`
+	CAFile         string        `yaml:"ca_file" toml:"ca_file"`
+	CertFile       string        `yaml:"cert_file" toml:"cert_file"`
+	KeyFile        string        `yaml:"key_file" toml:"key_file"`
+	ServerName     string        `yaml:"server_name" toml:"server_name"`
+	ReloadInterval time.Duration `yaml:"reload_interval" toml:"reload_interval"`
+}
+
+// CORSConfig — CORS-политика. В AllowOrigins допускаются шаблоны поддоменов
+// вида https://*.example.com и "*" (без AllowCredentials).
+type CORSConfig struct {
+	AllowOrigins     []string      `yaml:"allow_origins" toml:"allow_origins"`
+	AllowMethods     []string      `yaml:"allow_methods" toml:"allow_methods"`
+	AllowHeaders     []string      `yaml:"allow_headers" toml:"allow_headers"`
+	ExposeHeaders    []string      `yaml:"expose_headers" toml:"expose_headers"`
+	AllowCredentials bool          `yaml:"allow_credentials" toml:"allow_credentials"`
+	MaxAge           time.Duration `yaml:"max_age" toml:"max_age"`
+	// Профиль по имени окружения (или явно заданный Profile) переопределяет
+	// поля выше, которые в нём указаны.
+	Profile  string                 `yaml:"profile" toml:"profile"`
+	Profiles map[string]CORSProfile `yaml:"profiles" toml:"profiles"`
+}
+
+type CORSProfile struct {
+	AllowOrigins     []string       `yaml:"allow_origins" toml:"allow_origins"`
+	AllowMethods     []string       `yaml:"allow_methods" toml:"allow_methods"`
+	AllowHeaders     []string       `yaml:"allow_headers" toml:"allow_headers"`
+	ExposeHeaders    []string       `yaml:"expose_headers" toml:"expose_headers"`
+	AllowCredentials *bool          `yaml:"allow_credentials" toml:"allow_credentials"`
+	MaxAge           *time.Duration `yaml:"max_age" toml:"max_age"`
+}
+
+// ActiveCORS возвращает политику с применённым профилем: заданным явно
+// через cors.profile, иначе — по имени окружения, если такой профиль есть.
+func (c Config) ActiveCORS() (CORSConfig, error) {
+	policy := c.CORS
+	name := policy.Profile
+	if name == "" {
+		name = c.Env
+	}
+
+	profile, ok := policy.Profiles[name]
+	if !ok {
+		if policy.Profile != "" {
+			return policy, fmt.Errorf("cors.profile: unknown profile %q", policy.Profile)
+		}
+		return policy, nil
+	}
+
+	if profile.AllowOrigins != nil {
+		policy.AllowOrigins = profile.AllowOrigins
+	}
+	if profile.AllowMethods != nil {
+		policy.AllowMethods = profile.AllowMethods
+	}
+	if profile.AllowHeaders != nil {
+		policy.AllowHeaders = profile.AllowHeaders
+	}
+	if profile.ExposeHeaders != nil {
+		policy.ExposeHeaders = profile.ExposeHeaders
+	}
+	if profile.AllowCredentials != nil {
+		policy.AllowCredentials = *profile.AllowCredentials
+	}
+	if profile.MaxAge != nil {
+		policy.MaxAge = *profile.MaxAge
+	}
+	return policy, nil
+}
+
+type ExchangeRatesConfig struct {
+	Addr string `yaml:"addr" toml:"addr"`
+	// Сколько хранить курс из базы в кэше процесса
+	CacheTTL time.Duration   `yaml:"cache_ttl" toml:"cache_ttl"`
+	TLS      ClientTLSConfig `yaml:"tls" toml:"tls"`
+}
+
+type HealthConfig struct {
+	// Каталог миграций; /readyz не готов, пока в базе применены не все.
+	// Пустое значение отключает проверку.
+	MigrationsDir string        `yaml:"migrations_dir" toml:"migrations_dir"`
+	CheckTimeout  time.Duration `yaml:"check_timeout" toml:"check_timeout"`
+}
+
+// MetricsConfig — отдельный листенер для /metrics, недоступный снаружи
+// вместе с API. По умолчанию слушает только localhost; пустой адрес
+// отключает метрики.
+type MetricsConfig struct {
+	Addr string `yaml:"addr" toml:"addr"`
+}
+
+// WebhooksConfig — доставка вебхуков. Воркер можно выключить на части
+// экземпляров: события всё равно попадают в очередь и доставляются другими.
+type WebhooksConfig struct {
+	Enabled      bool          `yaml:"enabled" toml:"enabled"`
+	PollInterval time.Duration `yaml:"poll_interval" toml:"poll_interval"`
+	BatchSize    int           `yaml:"batch_size" toml:"batch_size"`
+	Timeout      time.Duration `yaml:"timeout" toml:"timeout"`
+	// После MaxAttempts неудачных попыток доставка уходит в dead letter.
+	// Пауза между попытками растёт вдвое от BackoffBase до BackoffMax.
+	MaxAttempts int           `yaml:"max_attempts" toml:"max_attempts"`
+	BackoffBase time.Duration `yaml:"backoff_base" toml:"backoff_base"`
+	BackoffMax  time.Duration `yaml:"backoff_max" toml:"backoff_max"`
+	// Разрешить адреса в локальной и частных сетях, например для отладки
+	AllowPrivateTargets bool `yaml:"allow_private_targets" toml:"allow_private_targets"`
+}
+
+// OutboxConfig — публикация событий кошелька из таблицы outbox в брокер.
+// Relay работает на всех экземплярах, но публикует в каждый момент только
+// один из них.
+type OutboxConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+	// kafka, nats или file
+	Broker         string        `yaml:"broker" toml:"broker"`
+	PollInterval   time.Duration `yaml:"poll_interval" toml:"poll_interval"`
+	BatchSize      int           `yaml:"batch_size" toml:"batch_size"`
+	PublishTimeout time.Duration `yaml:"publish_timeout" toml:"publish_timeout"`
+	// После стольких неудачных публикаций событие уходит в dead letter.
+	MaxAttempts int `yaml:"max_attempts" toml:"max_attempts"`
+	// Сколько хранить опубликованные события. 0 — не удалять.
+	Retention time.Duration     `yaml:"retention" toml:"retention"`
+	Kafka     OutboxKafkaConfig `yaml:"kafka" toml:"kafka"`
+	NATS      OutboxNATSConfig  `yaml:"nats" toml:"nats"`
+	// Файл для broker: file, по строке JSON на событие. "-" — stdout.
+	File string `yaml:"file" toml:"file"`
+}
+
+type OutboxKafkaConfig struct {
+	Brokers []string `yaml:"brokers" toml:"brokers"`
+	Topic   string   `yaml:"topic" toml:"topic"`
+}
+
+// OutboxNATSConfig — публикация в JetStream. Тема сообщения —
+// <subject>.<тип события>, например wallet.events.deposit.completed.
+type OutboxNATSConfig struct {
+	URL     string `yaml:"url" toml:"url"`
+	Subject string `yaml:"subject" toml:"subject"`
+}
+
+type TracingConfig struct {
+	Exporter     string `yaml:"exporter" toml:"exporter"` // none, otlp, stdout или file
+	ServiceName  string `yaml:"service_name" toml:"service_name"`
+	OTLPEndpoint string `yaml:"otlp_endpoint" toml:"otlp_endpoint"`
+	OTLPInsecure bool   `yaml:"otlp_insecure" toml:"otlp_insecure"`
+	File         string `yaml:"file" toml:"file"`
+	// Доля трассировок, которые сэмплируются, если у запроса нет родителя
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+}
+
+type PasswordHashConfig struct {
+	Algorithm         string `yaml:"algorithm" toml:"algorithm"`         // argon2id или bcrypt
+	Argon2Memory      uint32 `yaml:"argon2_memory" toml:"argon2_memory"` // KiB
+	Argon2Iterations  uint32 `yaml:"argon2_iterations" toml:"argon2_iterations"`
+	Argon2Parallelism uint8  `yaml:"argon2_parallelism" toml:"argon2_parallelism"`
+	BcryptCost        int    `yaml:"bcrypt_cost" toml:"bcrypt_cost"`
+}
+
+type CredentialsConfig struct {
+	PasswordMinLength     int    `yaml:"password_min_length" toml:"password_min_length"`
+	PasswordMaxLength     int    `yaml:"password_max_length" toml:"password_max_length"`
+	PasswordBlocklistFile string `yaml:"password_blocklist_file" toml:"password_blocklist_file"`
+	UsernameMinLength     int    `yaml:"username_min_length" toml:"username_min_length"`
+	UsernameMaxLength     int    `yaml:"username_max_length" toml:"username_max_length"`
+	UsernamePattern       string `yaml:"username_pattern" toml:"username_pattern"`
+	EmailMaxLength        int    `yaml:"email_max_length" toml:"email_max_length"`
+}
+
+type MailConfig struct {
+	Driver       string `yaml:"driver" toml:"driver"` // smtp, file или log
+	From         string `yaml:"from" toml:"from"`
+	SMTPHost     string `yaml:"smtp_host" toml:"smtp_host"`
+	SMTPPort     string `yaml:"smtp_port" toml:"smtp_port"`
+	SMTPUsername string `yaml:"smtp_username" toml:"smtp_username"`
+	SMTPPassword Secret `yaml:"smtp_password" toml:"smtp_password"`
+	FileDir      string `yaml:"file_dir" toml:"file_dir"`
+}
+
+type AccountConfig struct {
+	// Базовый адрес фронтенда для ссылок в письмах
+	AppBaseURL                string        `yaml:"app_base_url" toml:"app_base_url"`
+	EmailVerificationRequired bool          `yaml:"email_verification_required" toml:"email_verification_required"`
+	VerificationTokenTTL      time.Duration `yaml:"verification_token_ttl" toml:"verification_token_ttl"`
+	PasswordResetTokenTTL     time.Duration `yaml:"password_reset_token_ttl" toml:"password_reset_token_ttl"`
+}
+
+// FeesConfig — комиссии в процентах от суммы операции, округляются до
+// цента. За пополнение и обмен комиссия удерживается из суммы, за вывод
+// списывается сверх неё.
+type FeesConfig struct {
+	DepositPercent  float64 `yaml:"deposit_percent" toml:"deposit_percent"`
+	WithdrawPercent float64 `yaml:"withdraw_percent" toml:"withdraw_percent"`
+	ExchangePercent float64 `yaml:"exchange_percent" toml:"exchange_percent"`
+}
+
+// FeaturesConfig включает и выключает операции. Выключенная операция
+// отвечает 503 (в gRPC — Unavailable).
+type FeaturesConfig struct {
+	Deposit      bool `yaml:"deposit" toml:"deposit"`
+	Withdraw     bool `yaml:"withdraw" toml:"withdraw"`
+	Exchange     bool `yaml:"exchange" toml:"exchange"`
+	WalletStream bool `yaml:"wallet_stream" toml:"wallet_stream"`
+}
+
+type TOTPConfig struct {
+	Issuer        string `yaml:"issuer" toml:"issuer"`
+	EncryptionKey Secret `yaml:"encryption_key" toml:"encryption_key"`
+	// Вывод на сумму больше порога (в USD) требует свежий TOTP-код.
+	// 0 отключает step-up.
+	StepUpThreshold float64 `yaml:"step_up_threshold" toml:"step_up_threshold"`
+}
+
+// AuditConfig — журнал аудита. HMACKey подписывает цепочку записей; он
+// хранится вне базы, так что доступ на запись к базе не позволяет
+// пересчитать цепочку после правки записей.
+type AuditConfig struct {
+	HMACKey Secret `yaml:"hmac_key" toml:"hmac_key"`
+}
+
+type RateLimitConfig struct {
+	Enabled bool   `yaml:"enabled" toml:"enabled"`
+	Backend string `yaml:"backend" toml:"backend"` // memory или postgres
+	// Auth — политика маршрутов без аутентификации (AuthRoutes), у каждого
+	// маршрута своя корзина. Routes переопределяет её для отдельных маршрутов.
+	Auth   RateLimitPolicy            `yaml:"auth" toml:"auth"`
+	Routes map[string]RateLimitPolicy `yaml:"routes" toml:"routes"`
+	Wallet RateLimitPolicy            `yaml:"wallet" toml:"wallet"`
+}
+
+// Маршруты без аутентификации, лимит которых считается по IP.
+const (
+	RouteRegister           = "register"
+	RouteLogin              = "login"
+	RouteLoginTOTP          = "login_2fa"
+	RouteVerifyEmail        = "verify_email"
+	RouteResendVerification = "verify_email_resend"
+	RouteForgotPassword     = "password_forgot"
+	RouteResetPassword      = "password_reset"
+)
+
+var AuthRoutes = []string{
+	RouteRegister, RouteLogin, RouteLoginTOTP, RouteVerifyEmail,
+	RouteResendVerification, RouteForgotPassword, RouteResetPassword,
+}
+
+// AuthPolicy возвращает политику маршрута route: из Routes или Auth.
+func (r RateLimitConfig) AuthPolicy(route string) RateLimitPolicy {
+	if policy, ok := r.Routes[route]; ok {
+		return policy
+	}
+	return r.Auth
+}
+
+// RateLimitPolicy описывает token bucket: Rate токенов в секунду, не больше Burst.
+type RateLimitPolicy struct {
+	Rate  float64 `yaml:"rate" toml:"rate"`
+	Burst int     `yaml:"burst" toml:"burst"`
 }
 
 type DBConfig struct {
-	Host               string
-	Port               string
-	User               string
-	Password           string
-	DBName             string
-	SSLMode            string // Новое поле для sslmode
-	SSLRootCert        string // Новое поле для sslrootcert
-	TargetSessionAttrs string // Новое поле для target_session_attrs
+	Host               string `yaml:"host" toml:"host"`
+	Port               string `yaml:"port" toml:"port"`
+	User               string `yaml:"user" toml:"user"`
+	Password           Secret `yaml:"password" toml:"password"`
+	DBName             string `yaml:"name" toml:"name"`
+	SSLMode            string `yaml:"sslmode" toml:"sslmode"`                           // Новое поле для sslmode
+	SSLRootCert        string `yaml:"sslrootcert" toml:"sslrootcert"`                   // Новое поле для sslrootcert
+	TargetSessionAttrs string `yaml:"target_session_attrs" toml:"target_session_attrs"` // Новое поле для target_session_attrs
+}
+
+// EncryptionKey — ключ шифрования секретов в базе (TOTP, вебхуки). Он
+// обязателен и не совпадает с jwt_secret: утечка одного ключа не должна
+// раскрывать секреты, защищённые другим.
+func (c Config) EncryptionKey() string {
+	return c.TOTP.EncryptionKey.Value()
 }
 
 func (d DBConfig) ConnectionString() string {
 	// Формируем базовую строку подключения
 	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s target_session_attrs=%s",
-		d.Host, d.Port, d.User, d.Password, d.DBName, d.SSLMode, d.TargetSessionAttrs)
+		d.Host, d.Port, d.User, d.Password.Value(), d.DBName, d.SSLMode, d.TargetSessionAttrs)
 
 	// Если указан сертификат, добавляем его
 	if d.SSLRootCert != "" {
@@ -37,31 +384,481 @@ func (d DBConfig) ConnectionString() string {
 	return connStr
 }
 
-func LoadConfig(path string) (Config, error) {
-	if err := godotenv.Load(path); err != nil {
-		logrus.WithError(err).Warn("failed to load config file, using env vars")
+// LoadConfig собирает конфигурацию в три слоя: значения по умолчанию, файл
+// (.yaml/.yml, .toml или .env) и переменные окружения, которые главнее
+// файла. Результат проверяется через Validate. Предупреждения пишутся в
+// logger.
+func LoadConfig(path string, logger *logrus.Logger) (Config, error) {
+	cfg := defaults()
+	env := &envSource{}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := loadYAML(path, &cfg); err != nil {
+			return cfg, err
+		}
+	case ".toml":
+		if err := loadTOML(path, &cfg); err != nil {
+			return cfg, err
+		}
+	default:
+		vars, err := godotenv.Read(path)
+		if err != nil {
+			logger.WithError(err).Warn("failed to load config file, using env vars")
+		}
+		env.vars = vars
 	}
 
-	cfg := Config{
-		//HTTPPort:  getEnv("HTTP_PORT", ":8080"),
-		JWTSecret: getEnv("JWT_SECRET", "your-secret-key"),
+	env.apply(&cfg)
+
+	if err := errors.Join(append(env.errs, cfg.Validate())...); err != nil {
+		return cfg, err
+	}
+	for _, warning := range cfg.insecureDefaults() {
+		logger.WithField("setting", warning).Warn("insecure default in use, not allowed in production")
+	}
+	return cfg, nil
+}
+
+func loadYAML(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open config: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
+
+func loadTOML(path string, cfg *Config) error {
+	meta, err := toml.DecodeFile(path, cfg)
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return fmt.Errorf("parse %s: unknown keys %v", path, undecoded)
+	}
+	return nil
+}
+
+func defaults() Config {
+	return Config{
+		Env: EnvDevelopment,
+		LoggingConfig: LoggingConfig{
+			LogLevel:  "info",
+			LogFormat: "json",
+			LogRedact: []string{"email", "amount", "token", "username"},
+		},
+		WatchInterval: 10 * time.Second,
+		JWTSecret:     defaultJWTSecret,
 		DBConfig: DBConfig{
-			Host:               getEnv("DB_HOST", "localhost"),
-			Port:               getEnv("DB_PORT", "5432"),
-			User:               getEnv("DB_USER", "postgres"),
-			Password:           getEnv("DB_PASSWORD", "password"),
-			DBName:             getEnv("DB_NAME", "wallet"),
-			SSLMode:            getEnv("DB_SSLMODE", "verify-full"),             // Читаем DB_SSLMODE
-			SSLRootCert:        getEnv("DB_SSLROOTCERT", ""),                    // Читаем DB_SSLROOTCERT
-			TargetSessionAttrs: getEnv("DB_TARGET_SESSION_ATTRS", "read-write"), // Читаем DB_TARGET_SESSION_ATTRS
+			Host:               "localhost",
+			Port:               "5432",
+			User:               "postgres",
+			Password:           defaultDBPassword,
+			DBName:             "wallet",
+			SSLMode:            "verify-full",
+			TargetSessionAttrs: "read-write",
+		},
+		HTTP: HTTPConfig{
+			Port:              "8080",
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			MaxHeaderBytes:    1 << 20,
+			ShutdownTimeout:   20 * time.Second,
+			TLS: ServerTLSConfig{
+				MinVersion:     "1.2",
+				ReloadInterval: time.Minute,
+			},
+		},
+		GRPC: GRPCConfig{
+			Port:       "9090",
+			Reflection: false,
+		},
+		CORS: CORSConfig{
+			AllowOrigins:     []string{"http://158.160.136.178", "http://localhost:3000"},
+			AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowHeaders:     []string{"Content-Type", "Authorization", "X-API-Key", "X-Request-ID"},
+			ExposeHeaders:    []string{"Content-Length", "X-Request-ID"},
+			AllowCredentials: true,
+			MaxAge:           12 * time.Hour,
+		},
+		ExchangeRates: ExchangeRatesConfig{
+			Addr:     "exchange-rates-service:50051",
+			CacheTTL: 5 * time.Minute,
+			TLS: ClientTLSConfig{
+				ReloadInterval: time.Minute,
+			},
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Backend: "memory",
+			Auth:    RateLimitPolicy{Rate: 0.2, Burst: 5},
+			// Регистраций с одного адреса заметно меньше, чем входов.
+			Routes: map[string]RateLimitPolicy{
+				RouteRegister: {Rate: 0.01, Burst: 3},
+			},
+			Wallet: RateLimitPolicy{Rate: 5, Burst: 20},
+		},
+		TOTP: TOTPConfig{
+			Issuer:          "gw-currency-wallet",
+			StepUpThreshold: 1000,
+		},
+		Mail: MailConfig{
+			Driver:   "log",
+			From:     "no-reply@localhost",
+			SMTPHost: "localhost",
+			SMTPPort: "587",
+			FileDir:  "mail",
+		},
+		Account: AccountConfig{
+			AppBaseURL:                "http://localhost:3000",
+			EmailVerificationRequired: true,
+			VerificationTokenTTL:      48 * time.Hour,
+			PasswordResetTokenTTL:     time.Hour,
+		},
+		Features: FeaturesConfig{
+			Deposit:      true,
+			Withdraw:     true,
+			Exchange:     true,
+			WalletStream: true,
+		},
+		Credentials: CredentialsConfig{
+			PasswordMinLength:     8,
+			PasswordMaxLength:     72,
+			PasswordBlocklistFile: "data/common-passwords.txt",
+			UsernameMinLength:     3,
+			UsernameMaxLength:     50,
+			UsernamePattern:       `^[a-zA-Z0-9_.-]+$`,
+			EmailMaxLength:        100,
+		},
+		PasswordHash: PasswordHashConfig{
+			Algorithm:         "argon2id",
+			Argon2Memory:      64 * 1024,
+			Argon2Iterations:  3,
+			Argon2Parallelism: 2,
+			BcryptCost:        12,
+		},
+		Tracing: TracingConfig{
+			Exporter:     "none",
+			ServiceName:  "gw-currency-wallet",
+			OTLPEndpoint: "localhost:4317",
+			OTLPInsecure: true,
+			File:         "traces.json",
+			SampleRatio:  1,
+		},
+		Health: HealthConfig{
+			MigrationsDir: "migrations",
+			CheckTimeout:  2 * time.Second,
+		},
+		Metrics: MetricsConfig{
+			Addr: "127.0.0.1:9091",
+		},
+		Webhooks: WebhooksConfig{
+			Enabled:      true,
+			PollInterval: 5 * time.Second,
+			BatchSize:    20,
+			Timeout:      10 * time.Second,
+			MaxAttempts:  8,
+			BackoffBase:  30 * time.Second,
+			BackoffMax:   6 * time.Hour,
+		},
+		Outbox: OutboxConfig{
+			Enabled:        true,
+			Broker:         "file",
+			PollInterval:   time.Second,
+			BatchSize:      100,
+			PublishTimeout: 5 * time.Second,
+			MaxAttempts:    20,
+			Retention:      7 * 24 * time.Hour,
+			Kafka: OutboxKafkaConfig{
+				Brokers: []string{"localhost:9092"},
+				Topic:   "wallet.events",
+			},
+			NATS: OutboxNATSConfig{
+				URL:     "nats://localhost:4222",
+				Subject: "wallet.events",
+			},
+			File: "events.jsonl",
 		},
 	}
-	return cfg, nil
 }
 
-func getEnv(key, defaultValue string) string {
+// envSource — переменные из .env-файла. Переменные окружения процесса
+// главнее них. Файл не загружается в окружение процесса, чтобы при повторном
+// чтении изменённого файла новые значения не перекрывались старыми.
+// Неверные значения собираются в errs, и LoadConfig возвращает их вместе с
+// ошибками Validate.
+type envSource struct {
+	vars map[string]string
+	errs []error
+}
+
+func (e *envSource) invalid(key, value, kind string) {
+	e.errs = append(e.errs, fmt.Errorf("%s: invalid %s value %q", key, kind, value))
+}
+
+func (e *envSource) lookup(key string) (string, bool) {
 	if value, exists := os.LookupEnv(key); exists {
+		return value, true
+	}
+	value, exists := e.vars[key]
+	return value, exists
+}
+
+// apply переопределяет значения из файла переменными окружения.
+func (e *envSource) apply(cfg *Config) {
+	cfg.Env = e.getEnv("APP_ENV", cfg.Env)
+	cfg.LogLevel = e.getEnv("LOG_LEVEL", cfg.LogLevel)
+	cfg.LogFormat = e.getEnv("LOG_FORMAT", cfg.LogFormat)
+	cfg.LogRedact = e.getEnvList("LOG_REDACT", cfg.LogRedact)
+	cfg.WatchInterval = e.getEnvDuration("CONFIG_WATCH_INTERVAL", cfg.WatchInterval)
+	cfg.JWTSecret = Secret(e.getEnv("JWT_SECRET", cfg.JWTSecret.Value()))
+
+	db := &cfg.DBConfig
+	db.Host = e.getEnv("DB_HOST", db.Host)
+	db.Port = e.getEnv("DB_PORT", db.Port)
+	db.User = e.getEnv("DB_USER", db.User)
+	db.Password = Secret(e.getEnv("DB_PASSWORD", db.Password.Value()))
+	db.DBName = e.getEnv("DB_NAME", db.DBName)
+	db.SSLMode = e.getEnv("DB_SSLMODE", db.SSLMode)
+	db.SSLRootCert = e.getEnv("DB_SSLROOTCERT", db.SSLRootCert)
+	db.TargetSessionAttrs = e.getEnv("DB_TARGET_SESSION_ATTRS", db.TargetSessionAttrs)
+
+	h := &cfg.HTTP
+	h.Port = e.getEnv("PORT", h.Port)
+	h.ReadTimeout = e.getEnvDuration("HTTP_READ_TIMEOUT", h.ReadTimeout)
+	h.ReadHeaderTimeout = e.getEnvDuration("HTTP_READ_HEADER_TIMEOUT", h.ReadHeaderTimeout)
+	h.WriteTimeout = e.getEnvDuration("HTTP_WRITE_TIMEOUT", h.WriteTimeout)
+	h.IdleTimeout = e.getEnvDuration("HTTP_IDLE_TIMEOUT", h.IdleTimeout)
+	h.MaxHeaderBytes = e.getEnvInt("HTTP_MAX_HEADER_BYTES", h.MaxHeaderBytes)
+	h.ShutdownTimeout = e.getEnvDuration("HTTP_SHUTDOWN_TIMEOUT", h.ShutdownTimeout)
+	h.TLS.CertFile = e.getEnv("HTTP_TLS_CERT_FILE", h.TLS.CertFile)
+	h.TLS.KeyFile = e.getEnv("HTTP_TLS_KEY_FILE", h.TLS.KeyFile)
+	h.TLS.MinVersion = e.getEnv("HTTP_TLS_MIN_VERSION", h.TLS.MinVersion)
+	h.TLS.ReloadInterval = e.getEnvDuration("HTTP_TLS_RELOAD_INTERVAL", h.TLS.ReloadInterval)
+
+	cfg.GRPC.Port = e.getEnv("GRPC_PORT", cfg.GRPC.Port)
+	cfg.GRPC.Reflection = e.getEnvBool("GRPC_REFLECTION", cfg.GRPC.Reflection)
+
+	cors := &cfg.CORS
+	cors.AllowOrigins = e.getEnvList("CORS_ALLOW_ORIGINS", cors.AllowOrigins)
+	cors.AllowMethods = e.getEnvList("CORS_ALLOW_METHODS", cors.AllowMethods)
+	cors.AllowHeaders = e.getEnvList("CORS_ALLOW_HEADERS", cors.AllowHeaders)
+	cors.ExposeHeaders = e.getEnvList("CORS_EXPOSE_HEADERS", cors.ExposeHeaders)
+	cors.AllowCredentials = e.getEnvBool("CORS_ALLOW_CREDENTIALS", cors.AllowCredentials)
+	cors.MaxAge = e.getEnvDuration("CORS_MAX_AGE", cors.MaxAge)
+	cors.Profile = e.getEnv("CORS_PROFILE", cors.Profile)
+	cfg.ExchangeRates.Addr = e.getEnv("EXCHANGE_RATES_SERVICE_ADDR", cfg.ExchangeRates.Addr)
+	cfg.ExchangeRates.CacheTTL = e.getEnvDuration("RATE_CACHE_TTL", cfg.ExchangeRates.CacheTTL)
+	rt := &cfg.ExchangeRates.TLS
+	rt.Enabled = e.getEnvBool("EXCHANGE_RATES_TLS", rt.Enabled)
+	rt.CAFile = e.getEnv("EXCHANGE_RATES_TLS_CA_FILE", rt.CAFile)
+	rt.CertFile = e.getEnv("EXCHANGE_RATES_TLS_CERT_FILE", rt.CertFile)
+	rt.KeyFile = e.getEnv("EXCHANGE_RATES_TLS_KEY_FILE", rt.KeyFile)
+	rt.ServerName = e.getEnv("EXCHANGE_RATES_TLS_SERVER_NAME", rt.ServerName)
+	rt.ReloadInterval = e.getEnvDuration("EXCHANGE_RATES_TLS_RELOAD_INTERVAL", rt.ReloadInterval)
+
+	rl := &cfg.RateLimit
+	rl.Enabled = e.getEnvBool("RATE_LIMIT_ENABLED", rl.Enabled)
+	rl.Backend = e.getEnv("RATE_LIMIT_BACKEND", rl.Backend)
+	rl.Auth.Rate = e.getEnvFloat("RATE_LIMIT_AUTH_RATE", rl.Auth.Rate)
+	rl.Auth.Burst = e.getEnvInt("RATE_LIMIT_AUTH_BURST", rl.Auth.Burst)
+	for _, route := range AuthRoutes {
+		prefix := "RATE_LIMIT_" + strings.ToUpper(route)
+		_, hasRate := e.lookup(prefix + "_RATE")
+		_, hasBurst := e.lookup(prefix + "_BURST")
+		if !hasRate && !hasBurst {
+			continue
+		}
+		policy := rl.AuthPolicy(route)
+		policy.Rate = e.getEnvFloat(prefix+"_RATE", policy.Rate)
+		policy.Burst = e.getEnvInt(prefix+"_BURST", policy.Burst)
+		if rl.Routes == nil {
+			rl.Routes = make(map[string]RateLimitPolicy)
+		}
+		rl.Routes[route] = policy
+	}
+	rl.Wallet.Rate = e.getEnvFloat("RATE_LIMIT_WALLET_RATE", rl.Wallet.Rate)
+	rl.Wallet.Burst = e.getEnvInt("RATE_LIMIT_WALLET_BURST", rl.Wallet.Burst)
+
+	cfg.TOTP.Issuer = e.getEnv("TOTP_ISSUER", cfg.TOTP.Issuer)
+	cfg.TOTP.EncryptionKey = Secret(e.getEnv("TOTP_ENCRYPTION_KEY", cfg.TOTP.EncryptionKey.Value()))
+	cfg.TOTP.StepUpThreshold = e.getEnvFloat("TOTP_STEP_UP_THRESHOLD", cfg.TOTP.StepUpThreshold)
+
+	cfg.Audit.HMACKey = Secret(e.getEnv("AUDIT_HMAC_KEY", cfg.Audit.HMACKey.Value()))
+
+	m := &cfg.Mail
+	m.Driver = e.getEnv("MAIL_DRIVER", m.Driver)
+	m.From = e.getEnv("MAIL_FROM", m.From)
+	m.SMTPHost = e.getEnv("SMTP_HOST", m.SMTPHost)
+	m.SMTPPort = e.getEnv("SMTP_PORT", m.SMTPPort)
+	m.SMTPUsername = e.getEnv("SMTP_USERNAME", m.SMTPUsername)
+	m.SMTPPassword = Secret(e.getEnv("SMTP_PASSWORD", m.SMTPPassword.Value()))
+	m.FileDir = e.getEnv("MAIL_FILE_DIR", m.FileDir)
+
+	a := &cfg.Account
+	a.AppBaseURL = e.getEnv("APP_BASE_URL", a.AppBaseURL)
+	a.EmailVerificationRequired = e.getEnvBool("EMAIL_VERIFICATION_REQUIRED", a.EmailVerificationRequired)
+	a.VerificationTokenTTL = e.getEnvDuration("VERIFICATION_TOKEN_TTL", a.VerificationTokenTTL)
+	a.PasswordResetTokenTTL = e.getEnvDuration("PASSWORD_RESET_TOKEN_TTL", a.PasswordResetTokenTTL)
+
+	fee := &cfg.Fees
+	fee.DepositPercent = e.getEnvFloat("FEE_DEPOSIT_PERCENT", fee.DepositPercent)
+	fee.WithdrawPercent = e.getEnvFloat("FEE_WITHDRAW_PERCENT", fee.WithdrawPercent)
+	fee.ExchangePercent = e.getEnvFloat("FEE_EXCHANGE_PERCENT", fee.ExchangePercent)
+
+	f := &cfg.Features
+	f.Deposit = e.getEnvBool("FEATURE_DEPOSIT", f.Deposit)
+	f.Withdraw = e.getEnvBool("FEATURE_WITHDRAW", f.Withdraw)
+	f.Exchange = e.getEnvBool("FEATURE_EXCHANGE", f.Exchange)
+	f.WalletStream = e.getEnvBool("FEATURE_WALLET_STREAM", f.WalletStream)
+
+	cr := &cfg.Credentials
+	cr.PasswordMinLength = e.getEnvInt("PASSWORD_MIN_LENGTH", cr.PasswordMinLength)
+	cr.PasswordMaxLength = e.getEnvInt("PASSWORD_MAX_LENGTH", cr.PasswordMaxLength)
+	cr.PasswordBlocklistFile = e.getEnv("PASSWORD_BLOCKLIST_FILE", cr.PasswordBlocklistFile)
+	cr.UsernameMinLength = e.getEnvInt("USERNAME_MIN_LENGTH", cr.UsernameMinLength)
+	cr.UsernameMaxLength = e.getEnvInt("USERNAME_MAX_LENGTH", cr.UsernameMaxLength)
+	cr.UsernamePattern = e.getEnv("USERNAME_PATTERN", cr.UsernamePattern)
+	cr.EmailMaxLength = e.getEnvInt("EMAIL_MAX_LENGTH", cr.EmailMaxLength)
+
+	ph := &cfg.PasswordHash
+	ph.Algorithm = e.getEnv("PASSWORD_HASH_ALGORITHM", ph.Algorithm)
+	ph.Argon2Memory = uint32(e.getEnvUint("ARGON2_MEMORY", uint64(ph.Argon2Memory), 32))
+	ph.Argon2Iterations = uint32(e.getEnvUint("ARGON2_ITERATIONS", uint64(ph.Argon2Iterations), 32))
+	ph.Argon2Parallelism = uint8(e.getEnvUint("ARGON2_PARALLELISM", uint64(ph.Argon2Parallelism), 8))
+	ph.BcryptCost = e.getEnvInt("BCRYPT_COST", ph.BcryptCost)
+
+	t := &cfg.Tracing
+	t.Exporter = e.getEnv("TRACING_EXPORTER", t.Exporter)
+	t.ServiceName = e.getEnv("TRACING_SERVICE_NAME", t.ServiceName)
+	t.OTLPEndpoint = e.getEnv("TRACING_OTLP_ENDPOINT", t.OTLPEndpoint)
+	t.OTLPInsecure = e.getEnvBool("TRACING_OTLP_INSECURE", t.OTLPInsecure)
+	t.File = e.getEnv("TRACING_FILE", t.File)
+	t.SampleRatio = e.getEnvFloat("TRACING_SAMPLE_RATIO", t.SampleRatio)
+
+	cfg.Health.MigrationsDir = e.getEnv("MIGRATIONS_DIR", cfg.Health.MigrationsDir)
+	cfg.Health.CheckTimeout = e.getEnvDuration("HEALTH_CHECK_TIMEOUT", cfg.Health.CheckTimeout)
+	cfg.Metrics.Addr = e.getEnv("METRICS_ADDR", cfg.Metrics.Addr)
+
+	w := &cfg.Webhooks
+	w.Enabled = e.getEnvBool("WEBHOOKS_ENABLED", w.Enabled)
+	w.PollInterval = e.getEnvDuration("WEBHOOK_POLL_INTERVAL", w.PollInterval)
+	w.BatchSize = e.getEnvInt("WEBHOOK_BATCH_SIZE", w.BatchSize)
+	w.Timeout = e.getEnvDuration("WEBHOOK_TIMEOUT", w.Timeout)
+	w.MaxAttempts = e.getEnvInt("WEBHOOK_MAX_ATTEMPTS", w.MaxAttempts)
+	w.BackoffBase = e.getEnvDuration("WEBHOOK_BACKOFF_BASE", w.BackoffBase)
+	w.BackoffMax = e.getEnvDuration("WEBHOOK_BACKOFF_MAX", w.BackoffMax)
+	w.AllowPrivateTargets = e.getEnvBool("WEBHOOK_ALLOW_PRIVATE_TARGETS", w.AllowPrivateTargets)
+
+	o := &cfg.Outbox
+	o.Enabled = e.getEnvBool("OUTBOX_ENABLED", o.Enabled)
+	o.Broker = e.getEnv("OUTBOX_BROKER", o.Broker)
+	o.PollInterval = e.getEnvDuration("OUTBOX_POLL_INTERVAL", o.PollInterval)
+	o.BatchSize = e.getEnvInt("OUTBOX_BATCH_SIZE", o.BatchSize)
+	o.PublishTimeout = e.getEnvDuration("OUTBOX_PUBLISH_TIMEOUT", o.PublishTimeout)
+	o.MaxAttempts = e.getEnvInt("OUTBOX_MAX_ATTEMPTS", o.MaxAttempts)
+	o.Retention = e.getEnvDuration("OUTBOX_RETENTION", o.Retention)
+	o.Kafka.Brokers = e.getEnvList("OUTBOX_KAFKA_BROKERS", o.Kafka.Brokers)
+	o.Kafka.Topic = e.getEnv("OUTBOX_KAFKA_TOPIC", o.Kafka.Topic)
+	o.NATS.URL = e.getEnv("OUTBOX_NATS_URL", o.NATS.URL)
+	o.NATS.Subject = e.getEnv("OUTBOX_NATS_SUBJECT", o.NATS.Subject)
+	o.File = e.getEnv("OUTBOX_FILE", o.File)
+}
+
+func (e *envSource) getEnv(key, defaultValue string) string {
+	if value, exists := e.lookup(key); exists {
 		return value
 	}
 	return defaultValue
 }
+
+// getEnvList читает список через запятую.
+func (e *envSource) getEnvList(key string, defaultValue []string) []string {
+	value, exists := e.lookup(key)
+	if !exists {
+		return defaultValue
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func (e *envSource) getEnvInt(key string, defaultValue int) int {
+	value, exists := e.lookup(key)
+	if !exists {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		e.invalid(key, value, "integer")
+		return defaultValue
+	}
+	return parsed
+}
+
+// getEnvUint разбирает беззнаковое число, которое помещается в bitSize бит,
+// так что приведение к типу поля не переполняется.
+func (e *envSource) getEnvUint(key string, defaultValue uint64, bitSize int) uint64 {
+	value, exists := e.lookup(key)
+	if !exists {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseUint(value, 10, bitSize)
+	if err != nil {
+		e.invalid(key, value, fmt.Sprintf("uint%d", bitSize))
+		return defaultValue
+	}
+	return parsed
+}
+
+func (e *envSource) getEnvFloat(key string, defaultValue float64) float64 {
+	value, exists := e.lookup(key)
+	if !exists {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		e.invalid(key, value, "float")
+		return defaultValue
+	}
+	return parsed
+}
+
+func (e *envSource) getEnvBool(key string, defaultValue bool) bool {
+	value, exists := e.lookup(key)
+	if !exists {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		e.invalid(key, value, "boolean")
+		return defaultValue
+	}
+	return parsed
+}
+
+func (e *envSource) getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, exists := e.lookup(key)
+	if !exists {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		e.invalid(key, value, "duration")
+		return defaultValue
+	}
+	return parsed
+}
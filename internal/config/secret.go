@@ -0,0 +1,31 @@
+package config
+
+const redacted = "[REDACTED]"
+
+// Secret — строка, которая не попадает в логи: при форматировании и
+// сериализации в JSON вместо значения выводится [REDACTED]. Само значение
+// возвращает Value.
+type Secret string
+
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return `"` + s.String() + `"`
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + s.String() + `"`), nil
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultJWTSecret     Secret = "your-secret-key"
+	defaultDBPassword    Secret = "password"
+	defaultEncryptionKey Secret = "your-encryption-key" // из config.env
+	defaultAuditHMACKey  Secret = "your-audit-key"      // из config.env
+
+	minJWTSecretLength     = 32
+	minEncryptionKeyLength = 32
+
+	// Минимум памяти Argon2id по рекомендации OWASP (19 MiB), KiB.
+	minArgon2Memory = 19 * 1024
+	// Границы стоимости bcrypt.MinCost и bcrypt.MaxCost.
+	minBcryptCost = 4
+	maxBcryptCost = 31
+)
+
+// Категории маскирования из internal/logging
+var redactCategories = map[string]bool{"email": true, "amount": true, "token": true, "username": true}
+
+// Validate проверяет значения целиком и возвращает все найденные ошибки
+// сразу, чтобы их можно было исправить за один заход.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Env == EnvDevelopment || c.Env == EnvProduction, "env: must be %q or %q, got %q", EnvDevelopment, EnvProduction, c.Env)
+	_, err := logrus.ParseLevel(c.LogLevel)
+	check(err == nil, "log_level: unknown level %q", c.LogLevel)
+	check(c.LogFormat == "json" || c.LogFormat == "text", "log_format: must be json or text, got %q", c.LogFormat)
+	for _, category := range c.LogRedact {
+		check(redactCategories[category], "log_redact: unknown category %q", category)
+	}
+
+	check(c.JWTSecret != "", "jwt_secret: must not be empty")
+	check(c.TOTP.EncryptionKey != "", "totp.encryption_key: must not be empty")
+	check(c.TOTP.EncryptionKey != c.JWTSecret, "totp.encryption_key: must differ from jwt_secret")
+	check(c.Audit.HMACKey != "", "audit.hmac_key: must not be empty")
+	check(c.Audit.HMACKey != c.JWTSecret && c.Audit.HMACKey != c.TOTP.EncryptionKey,
+		"audit.hmac_key: must differ from jwt_secret and totp.encryption_key")
+	check(c.DBConfig.Host != "", "db.host: must not be empty")
+	check(validPort(c.DBConfig.Port), "db.port: invalid port %q", c.DBConfig.Port)
+	check(c.DBConfig.DBName != "", "db.name: must not be empty")
+
+	check(validPort(c.HTTP.Port), "http.port: invalid port %q", c.HTTP.Port)
+	check(c.HTTP.ReadTimeout > 0 && c.HTTP.ReadHeaderTimeout > 0 && c.HTTP.WriteTimeout > 0 && c.HTTP.IdleTimeout > 0,
+		"http: timeouts must be positive")
+	check(c.HTTP.MaxHeaderBytes > 0, "http.max_header_bytes: must be positive")
+	check(c.HTTP.ShutdownTimeout > 0, "http.shutdown_timeout: must be positive")
+	check(validPort(c.GRPC.Port), "grpc.port: invalid port %q", c.GRPC.Port)
+	check(c.GRPC.Port != c.HTTP.Port, "grpc.port: must differ from http.port")
+	check(c.ExchangeRates.Addr != "", "exchange_rates.addr: must not be empty")
+
+	serverTLS := c.HTTP.TLS
+	check((serverTLS.CertFile == "") == (serverTLS.KeyFile == ""), "http.tls: cert_file and key_file must be set together")
+	check(serverTLS.MinVersion == "1.2" || serverTLS.MinVersion == "1.3", "http.tls.min_version: must be 1.2 or 1.3, got %q", serverTLS.MinVersion)
+	check(serverTLS.ReloadInterval >= 0, "http.tls.reload_interval: must not be negative")
+
+	clientTLS := c.ExchangeRates.TLS
+	check((clientTLS.CertFile == "") == (clientTLS.KeyFile == ""), "exchange_rates.tls: cert_file and key_file must be set together")
+	check(clientTLS.Enabled || (clientTLS.CAFile == "" && clientTLS.CertFile == "" && clientTLS.ServerName == ""),
+		"exchange_rates.tls: ca_file, cert_file and server_name require enabled: true")
+	check(clientTLS.ReloadInterval >= 0, "exchange_rates.tls.reload_interval: must not be negative")
+	check(c.ExchangeRates.CacheTTL > 0, "exchange_rates.cache_ttl: must be positive")
+	check(c.WatchInterval >= 0, "watch_interval: must not be negative")
+
+	if cors, err := c.ActiveCORS(); err != nil {
+		errs = append(errs, err)
+	} else {
+		check(len(cors.AllowOrigins) > 0, "cors.allow_origins: must not be empty")
+		check(cors.MaxAge >= 0, "cors.max_age: must not be negative")
+	}
+
+	check(c.RateLimit.Backend == "memory" || c.RateLimit.Backend == "postgres",
+		"rate_limit.backend: must be memory or postgres, got %q", c.RateLimit.Backend)
+	for name, policy := range map[string]RateLimitPolicy{"auth": c.RateLimit.Auth, "wallet": c.RateLimit.Wallet} {
+		check(policy.Rate > 0 && policy.Burst > 0, "rate_limit.%s: rate and burst must be positive", name)
+	}
+	for route, policy := range c.RateLimit.Routes {
+		check(slices.Contains(AuthRoutes, route), "rate_limit.routes: unknown route %q", route)
+		check(policy.Rate > 0 && policy.Burst > 0, "rate_limit.routes.%s: rate and burst must be positive", route)
+	}
+
+	check(c.TOTP.StepUpThreshold >= 0, "totp.step_up_threshold: must not be negative")
+
+	switch c.Mail.Driver {
+	case "smtp":
+		check(c.Mail.SMTPHost != "" && validPort(c.Mail.SMTPPort), "mail: smtp driver requires smtp_host and a valid smtp_port")
+	case "file":
+		check(c.Mail.FileDir != "", "mail.file_dir: required for the file driver")
+	case "log":
+	default:
+		errs = append(errs, fmt.Errorf("mail.driver: must be smtp, file or log, got %q", c.Mail.Driver))
+	}
+
+	check(c.Account.VerificationTokenTTL > 0 && c.Account.PasswordResetTokenTTL > 0, "account: token TTLs must be positive")
+	for name, percent := range map[string]float64{
+		"deposit_percent":  c.Fees.DepositPercent,
+		"withdraw_percent": c.Fees.WithdrawPercent,
+		"exchange_percent": c.Fees.ExchangePercent,
+	} {
+		check(percent >= 0 && percent < 100, "fees.%s: must be in [0, 100)", name)
+	}
+
+	cr := c.Credentials
+	check(cr.PasswordMinLength > 0 && cr.PasswordMinLength <= cr.PasswordMaxLength,
+		"credentials: password_min_length must be positive and not exceed password_max_length")
+	check(cr.UsernameMinLength > 0 && cr.UsernameMinLength <= cr.UsernameMaxLength,
+		"credentials: username_min_length must be positive and not exceed username_max_length")
+	_, err = regexp.Compile(cr.UsernamePattern)
+	check(err == nil, "credentials.username_pattern: %v", err)
+
+	check(c.PasswordHash.Algorithm == "argon2id" || c.PasswordHash.Algorithm == "bcrypt",
+		"password_hash.algorithm: must be argon2id or bcrypt, got %q", c.PasswordHash.Algorithm)
+	ph := c.PasswordHash
+	check(ph.Argon2Memory >= minArgon2Memory, "password_hash.argon2_memory: must be at least %d KiB", minArgon2Memory)
+	check(ph.Argon2Iterations >= 1, "password_hash.argon2_iterations: must be at least 1")
+	check(ph.Argon2Parallelism >= 1, "password_hash.argon2_parallelism: must be at least 1")
+	check(ph.BcryptCost >= minBcryptCost && ph.BcryptCost <= maxBcryptCost,
+		"password_hash.bcrypt_cost: must be between %d and %d", minBcryptCost, maxBcryptCost)
+
+	switch c.Tracing.Exporter {
+	case "none", "otlp", "stdout", "file":
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter: must be none, otlp, stdout or file, got %q", c.Tracing.Exporter))
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio: must be between 0 and 1")
+	check(c.Health.CheckTimeout > 0, "health.check_timeout: must be positive")
+	if c.Metrics.Addr != "" {
+		_, _, err := net.SplitHostPort(c.Metrics.Addr)
+		check(err == nil, "metrics.addr: must be host:port, got %q", c.Metrics.Addr)
+	}
+
+	w := c.Webhooks
+	check(w.PollInterval > 0 && w.Timeout > 0, "webhooks: poll_interval and timeout must be positive")
+	check(w.BatchSize > 0, "webhooks.batch_size: must be positive")
+	check(w.MaxAttempts > 0, "webhooks.max_attempts: must be positive")
+	check(w.BackoffBase > 0 && w.BackoffBase <= w.BackoffMax, "webhooks: backoff_base must be positive and not exceed backoff_max")
+
+	o := c.Outbox
+	switch o.Broker {
+	case "kafka":
+		check(len(o.Kafka.Brokers) > 0 && o.Kafka.Topic != "", "outbox.kafka: brokers and topic are required")
+	case "nats":
+		check(o.NATS.URL != "" && o.NATS.Subject != "", "outbox.nats: url and subject are required")
+	case "file":
+		check(o.File != "", "outbox.file: is required")
+	default:
+		errs = append(errs, fmt.Errorf("outbox.broker: must be kafka, nats or file, got %q", o.Broker))
+	}
+	check(o.PollInterval > 0 && o.PublishTimeout > 0, "outbox: poll_interval and publish_timeout must be positive")
+	check(o.BatchSize > 0, "outbox.batch_size: must be positive")
+	check(o.MaxAttempts > 0, "outbox.max_attempts: must be positive")
+	check(o.Retention >= 0, "outbox.retention: must not be negative")
+
+	if c.Env == EnvProduction {
+		for _, setting := range c.insecureDefaults() {
+			errs = append(errs, fmt.Errorf("%s: insecure value is not allowed in production", setting))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// insecureDefaults перечисляет секреты, оставленные по умолчанию или
+// слишком слабые для production.
+func (c Config) insecureDefaults() []string {
+	var settings []string
+	if c.JWTSecret == defaultJWTSecret || len(c.JWTSecret) < minJWTSecretLength {
+		settings = append(settings, "jwt_secret")
+	}
+	if c.DBConfig.Password == defaultDBPassword || c.DBConfig.Password == "" {
+		settings = append(settings, "db.password")
+	}
+	// Ключ AES выводится из строки простым SHA-256, так что слабая или
+	// известная строка раскрывает все секреты в базе.
+	if c.TOTP.EncryptionKey == defaultEncryptionKey || len(c.TOTP.EncryptionKey) < minEncryptionKeyLength {
+		settings = append(settings, "totp.encryption_key")
+	}
+	if c.Audit.HMACKey == defaultAuditHMACKey || len(c.Audit.HMACKey) < minEncryptionKeyLength {
+		settings = append(settings, "audit.hmac_key")
+	}
+	if c.DBConfig.SSLMode == "disable" {
+		settings = append(settings, "db.sslmode")
+	}
+	// У gRPC нет своих настроек TLS: без сертификата HTTP он принимал бы
+	// JWT и API-ключи открытым текстом.
+	if !c.HTTP.TLS.Enabled() {
+		settings = append(settings, "http.tls")
+	}
+	// Письма никуда не уходят, пользователи не получат ссылки.
+	if c.Mail.Driver == "log" {
+		settings = append(settings, "mail.driver")
+	}
+	return settings
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n < 65536
+}
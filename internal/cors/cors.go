@@ -0,0 +1,123 @@
+package cors
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	gincors "github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware применяет CORS-политику из конфигурации. Политику можно
+// заменить на лету через Update, не пересобирая роутер.
+type Middleware struct {
+	handler atomic.Pointer[gin.HandlerFunc]
+}
+
+func New(cfg config.CORSConfig) (*Middleware, error) {
+	m := &Middleware{}
+	if err := m.Update(cfg); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Update собирает новую политику и атомарно подменяет текущую. При ошибке
+// продолжает действовать прежняя.
+func (m *Middleware) Update(cfg config.CORSConfig) error {
+	corsConfig, err := build(cfg)
+	if err != nil {
+		return err
+	}
+	handler := gincors.New(corsConfig)
+	m.handler.Store(&handler)
+	return nil
+}
+
+func (m *Middleware) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		(*m.handler.Load())(c)
+	}
+}
+
+func build(cfg config.CORSConfig) (gincors.Config, error) {
+	corsConfig := gincors.Config{
+		AllowMethods:     cfg.AllowMethods,
+		AllowHeaders:     cfg.AllowHeaders,
+		ExposeHeaders:    cfg.ExposeHeaders,
+		AllowCredentials: cfg.AllowCredentials,
+		MaxAge:           cfg.MaxAge,
+	}
+
+	var patterns []pattern
+	for _, origin := range cfg.AllowOrigins {
+		switch {
+		case origin == "*":
+			if cfg.AllowCredentials {
+				return corsConfig, fmt.Errorf("cors: origin * cannot be combined with allow_credentials")
+			}
+			corsConfig.AllowAllOrigins = true
+		case strings.Contains(origin, "*"):
+			p, err := parsePattern(origin)
+			if err != nil {
+				return corsConfig, err
+			}
+			patterns = append(patterns, p)
+		default:
+			corsConfig.AllowOrigins = append(corsConfig.AllowOrigins, origin)
+		}
+	}
+
+	if corsConfig.AllowAllOrigins {
+		corsConfig.AllowOrigins = nil
+		patterns = nil
+	}
+	if len(patterns) > 0 {
+		corsConfig.AllowOriginFunc = func(origin string) bool {
+			for _, p := range patterns {
+				if p.match(origin) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	if err := corsConfig.Validate(); err != nil {
+		return corsConfig, fmt.Errorf("cors: %w", err)
+	}
+	return corsConfig, nil
+}
+
+// pattern — origin вида https://*.example.com: подходит любой поддомен
+// example.com (но не сам example.com) с той же схемой и портом.
+type pattern struct {
+	scheme string
+	suffix string
+	port   string
+}
+
+func parsePattern(origin string) (pattern, error) {
+	scheme, rest, ok := strings.Cut(origin, "://")
+	if !ok || !strings.HasPrefix(rest, "*.") || strings.Count(rest, "*") != 1 {
+		return pattern{}, fmt.Errorf("cors: invalid origin pattern %q, expected scheme://*.domain", origin)
+	}
+
+	u, err := url.Parse(scheme + "://" + strings.TrimPrefix(rest, "*"))
+	if err != nil || u.Path != "" || strings.Trim(u.Hostname(), ".") == "" {
+		return pattern{}, fmt.Errorf("cors: invalid origin pattern %q, expected scheme://*.domain", origin)
+	}
+	return pattern{scheme: u.Scheme, suffix: strings.ToLower(u.Hostname()), port: u.Port()}, nil
+}
+
+func (p pattern) match(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme != p.scheme || u.Port() != p.port || u.Path != "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	return strings.HasSuffix(host, p.suffix) && len(host) > len(p.suffix)
+}
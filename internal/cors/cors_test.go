@@ -0,0 +1,50 @@
+package cors
+
+import "testing"
+
+func TestPatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		origin  string
+		ok      bool
+	}{
+		{"https://*.example.com", "https://app.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", true},
+		{"https://*.example.com", "https://APP.Example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://.example.com", false},
+		{"https://*.example.com", "https://evilexample.com", false},
+		{"https://*.example.com", "https://app.example.com.evil.com", false},
+		{"https://*.example.com", "http://app.example.com", false},
+		{"https://*.example.com", "https://app.example.com:8443", false},
+		{"https://*.example.com", "https://app.example.com/path", false},
+		{"https://*.example.com:8443", "https://app.example.com:8443", true},
+		{"https://*.example.com:8443", "https://app.example.com", false},
+		{"https://*.example.com:8443", "https://app.example.com:9443", false},
+		{"http://*.localhost:3000", "http://web.localhost:3000", true},
+	}
+	for _, tt := range tests {
+		p, err := parsePattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("parsePattern(%q): %v", tt.pattern, err)
+		}
+		if got := p.match(tt.origin); got != tt.ok {
+			t.Errorf("%s matches %s = %v, want %v", tt.pattern, tt.origin, got, tt.ok)
+		}
+	}
+}
+
+func TestParsePatternInvalid(t *testing.T) {
+	for _, pattern := range []string{
+		"*.example.com",
+		"https://app.*.example.com",
+		"https://*.*.example.com",
+		"https://*example.com",
+		"https://*.example.com/path",
+		"https://*.",
+	} {
+		if _, err := parsePattern(pattern); err == nil {
+			t.Errorf("parsePattern(%q) accepted", pattern)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package credentials
+
+import (
+	"bufio"
+	"fmt"
+	"net/mail"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"github.com/Krchnk/gw-currency-wallet/internal/validation"
+	"github.com/sirupsen/logrus"
+)
+
+// FieldError описывает нарушение политики для конкретного поля запроса.
+// Формат тот же, что у ошибок валидации тела запроса.
+type FieldError = validation.FieldError
+
+// Policy проверяет имя пользователя, пароль и email при регистрации и
+// смене пароля.
+type Policy struct {
+	cfg             config.CredentialsConfig
+	usernamePattern *regexp.Regexp
+	blocklist       map[string]struct{}
+}
+
+func NewPolicy(cfg config.CredentialsConfig, logger *logrus.Logger) (*Policy, error) {
+	pattern, err := regexp.Compile(cfg.UsernamePattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid username pattern: %w", err)
+	}
+
+	blocklist, err := loadBlocklist(cfg.PasswordBlocklistFile, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Policy{
+		cfg:             cfg,
+		usernamePattern: pattern,
+		blocklist:       blocklist,
+	}, nil
+}
+
+func (p *Policy) ValidateRegistration(username, password, email string) []FieldError {
+	var errs []FieldError
+	errs = append(errs, p.ValidateUsername(username)...)
+	errs = append(errs, p.ValidatePassword("password", password, username)...)
+	errs = append(errs, p.ValidateEmail(email)...)
+	return errs
+}
+
+func (p *Policy) ValidateUsername(username string) []FieldError {
+	length := utf8.RuneCountInString(username)
+	switch {
+	case length < p.cfg.UsernameMinLength:
+		return []FieldError{{Field: "username", Message: fmt.Sprintf("must be at least %d characters", p.cfg.UsernameMinLength)}}
+	case length > p.cfg.UsernameMaxLength:
+		return []FieldError{{Field: "username", Message: fmt.Sprintf("must be at most %d characters", p.cfg.UsernameMaxLength)}}
+	case !p.usernamePattern.MatchString(username):
+		return []FieldError{{Field: "username", Message: "contains characters that are not allowed"}}
+	}
+	return nil
+}
+
+// ValidatePassword проверяет пароль; field задаёт имя поля в ошибке,
+// так как в разных запросах пароль называется по-разному.
+func (p *Policy) ValidatePassword(field, password, username string) []FieldError {
+	var errs []FieldError
+
+	if utf8.RuneCountInString(password) < p.cfg.PasswordMinLength {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("must be at least %d characters", p.cfg.PasswordMinLength)})
+	}
+	// bcrypt учитывает только первые 72 байта, поэтому ограничиваем длину в байтах.
+	if len(password) > p.cfg.PasswordMaxLength {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("must be at most %d bytes", p.cfg.PasswordMaxLength)})
+	}
+	if _, found := p.blocklist[strings.ToLower(password)]; found {
+		errs = append(errs, FieldError{Field: field, Message: "is too common"})
+	}
+	if username != "" && strings.EqualFold(password, username) {
+		errs = append(errs, FieldError{Field: field, Message: "must not match the username"})
+	}
+	return errs
+}
+
+// ValidateEmail принимает только голый адрес по RFC 5322, без отображаемого
+// имени и угловых скобок.
+func (p *Policy) ValidateEmail(email string) []FieldError {
+	if len(email) > p.cfg.EmailMaxLength {
+		return []FieldError{{Field: "email", Message: fmt.Sprintf("must be at most %d characters", p.cfg.EmailMaxLength)}}
+	}
+
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return []FieldError{{Field: "email", Message: "is not a valid email address"}}
+	}
+	return nil
+}
+
+func loadBlocklist(path string, logger *logrus.Logger) (map[string]struct{}, error) {
+	blocklist := make(map[string]struct{})
+	if path == "" {
+		return blocklist, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open password blocklist: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		blocklist[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read password blocklist: %w", err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		"path":    path,
+		"entries": len(blocklist),
+	}).Info("password blocklist loaded")
+	return blocklist, nil
+}
@@ -0,0 +1,113 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	walletv1 "github.com/Krchnk/gw-currency-wallet/api/wallet/v1"
+	"github.com/Krchnk/gw-currency-wallet/internal/handlers"
+	"github.com/Krchnk/gw-currency-wallet/internal/logging"
+	"github.com/Krchnk/gw-currency-wallet/internal/ratelimit"
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Области API-ключа для методов WalletService — те же, что у REST-маршрутов.
+var methodScopes = map[string]string{
+	walletv1.WalletService_GetBalance_FullMethodName:       handlers.ScopeReadBalance,
+	walletv1.WalletService_Deposit_FullMethodName:          handlers.ScopeWriteDeposit,
+	walletv1.WalletService_Withdraw_FullMethodName:         handlers.ScopeWriteWithdraw,
+	walletv1.WalletService_Exchange_FullMethodName:         handlers.ScopeWriteExchange,
+	walletv1.WalletService_ListTransactions_FullMethodName: handlers.ScopeReadBalance,
+}
+
+type principalKey struct{}
+
+// Authenticator проверяет учётные данные так же, как AuthMiddleware REST API.
+type Authenticator interface {
+	Authenticate(ctx context.Context, authorization, apiKey string) (handlers.Principal, error)
+	AuditScopeDenied(ctx context.Context, scope, target string)
+}
+
+// UnaryAuthInterceptor требует JWT или API-ключ в метаданных
+// ("authorization: Bearer <JWT>" или "x-api-key") для методов WalletService.
+// Reflection и health-проверки доступны без аутентификации.
+func UnaryAuthInterceptor(auth Authenticator, logger *logrus.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		scope, protected := methodScopes[info.FullMethod]
+		if !protected {
+			if strings.HasPrefix(info.FullMethod, "/"+walletv1.WalletService_ServiceDesc.ServiceName+"/") {
+				return nil, status.Error(codes.PermissionDenied, "method is not mapped to a scope")
+			}
+			return handler(ctx, req)
+		}
+
+		principal, err := auth.Authenticate(ctx, firstValue(ctx, "authorization"), firstValue(ctx, "x-api-key"))
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, "unauthenticated")
+		}
+		ctx = logging.WithFields(ctx, principal.LogFields())
+		ctx = storages.WithAuditActor(ctx, storages.AuditActor{
+			UserID:    principal.UserID,
+			APIKeyID:  principal.APIKeyID,
+			IP:        peerIP(ctx),
+			UserAgent: firstValue(ctx, "user-agent"),
+		})
+		if !principal.HasScope(scope) {
+			logger.WithContext(ctx).WithFields(logrus.Fields{
+				"api_key_id": principal.APIKeyID,
+				"scope":      scope,
+				"method":     info.FullMethod,
+			}).Error("api key lacks required scope")
+			auth.AuditScopeDenied(ctx, scope, info.FullMethod)
+			return nil, status.Errorf(codes.PermissionDenied, "api key lacks scope %s", scope)
+		}
+
+		return handler(context.WithValue(ctx, principalKey{}, principal), req)
+	}
+}
+
+// RateLimitKey — ключ лимита для аутентифицированного вызова, тот же, что
+// у REST API; "" для методов без аутентификации.
+func RateLimitKey(ctx context.Context) string {
+	if principal := principalFrom(ctx); principal.UserID != "" {
+		return ratelimit.UserKey(principal.UserID)
+	}
+	return ""
+}
+
+// principalFrom возвращает субъекта, сохранённого UnaryAuthInterceptor.
+func principalFrom(ctx context.Context) handlers.Principal {
+	principal, _ := ctx.Value(principalKey{}).(handlers.Principal)
+	return principal
+}
+
+// peerIP — адрес клиента без порта, как c.ClientIP() в REST API.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+func firstValue(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
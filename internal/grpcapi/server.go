@@ -0,0 +1,164 @@
+package grpcapi
+
+import (
+	"context"
+	"time"
+
+	walletv1 "github.com/Krchnk/gw-currency-wallet/api/wallet/v1"
+	"github.com/Krchnk/gw-currency-wallet/internal/handlers"
+	"github.com/Krchnk/gw-currency-wallet/internal/requestid"
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Wallet — операции кошелька, которые gRPC API делит с REST API
+// (реализуются handlers.Handler).
+type Wallet interface {
+	Authenticator
+	Balance(ctx context.Context, userID string) (map[string]float64, error)
+	DepositFunds(ctx context.Context, userID, currency string, amount float64) (map[string]float64, error)
+	WithdrawFunds(ctx context.Context, userID, currency string, amount float64, totpCode string) (map[string]float64, error)
+	ExchangeFunds(ctx context.Context, userID, from, to string, amount float64) (float64, map[string]float64, error)
+	Transactions(ctx context.Context, userID string, beforeID int64, limit int) ([]storages.Transaction, error)
+}
+
+// NewServer собирает gRPC-сервер с WalletService, health-сервисом и, если
+// включено, reflection. creds == nil — соединения без TLS. interceptors
+// выполняются после аутентификации, например лимит запросов. Статус
+// health-сервиса — SERVING; при остановке его переключает Shutdown у
+// возвращённого health.Server.
+func NewServer(wallet Wallet, logger *logrus.Logger, creds credentials.TransportCredentials, enableReflection bool, interceptors ...grpc.UnaryServerInterceptor) (*grpc.Server, *health.Server) {
+	chain := append([]grpc.UnaryServerInterceptor{
+		requestid.UnaryServerInterceptor(),
+		unaryLoggingInterceptor(logger),
+		UnaryAuthInterceptor(wallet, logger),
+	}, interceptors...)
+	opts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(chain...),
+	}
+	if creds != nil {
+		opts = append(opts, grpc.Creds(creds))
+	}
+
+	srv := grpc.NewServer(opts...)
+	walletv1.RegisterWalletServiceServer(srv, &walletServer{wallet: wallet, logger: logger})
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus(walletv1.WalletService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, healthServer)
+
+	if enableReflection {
+		reflection.Register(srv)
+	}
+	return srv, healthServer
+}
+
+type walletServer struct {
+	walletv1.UnimplementedWalletServiceServer
+	wallet Wallet
+	logger *logrus.Logger
+}
+
+func (s *walletServer) GetBalance(ctx context.Context, _ *walletv1.GetBalanceRequest) (*walletv1.GetBalanceResponse, error) {
+	balance, err := s.wallet.Balance(ctx, principalFrom(ctx).UserID)
+	if err != nil {
+		return nil, s.toStatus(ctx, "GetBalance", err)
+	}
+	return &walletv1.GetBalanceResponse{Balance: balance}, nil
+}
+
+func (s *walletServer) Deposit(ctx context.Context, req *walletv1.DepositRequest) (*walletv1.DepositResponse, error) {
+	balance, err := s.wallet.DepositFunds(ctx, principalFrom(ctx).UserID, req.GetCurrency(), req.GetAmount())
+	if err != nil {
+		return nil, s.toStatus(ctx, "Deposit", err)
+	}
+	return &walletv1.DepositResponse{Balance: balance}, nil
+}
+
+func (s *walletServer) Withdraw(ctx context.Context, req *walletv1.WithdrawRequest) (*walletv1.WithdrawResponse, error) {
+	balance, err := s.wallet.WithdrawFunds(ctx, principalFrom(ctx).UserID, req.GetCurrency(), req.GetAmount(), req.GetTotpCode())
+	if err != nil {
+		return nil, s.toStatus(ctx, "Withdraw", err)
+	}
+	return &walletv1.WithdrawResponse{Balance: balance}, nil
+}
+
+func (s *walletServer) Exchange(ctx context.Context, req *walletv1.ExchangeRequest) (*walletv1.ExchangeResponse, error) {
+	exchanged, balance, err := s.wallet.ExchangeFunds(ctx, principalFrom(ctx).UserID, req.GetFromCurrency(), req.GetToCurrency(), req.GetAmount())
+	if err != nil {
+		return nil, s.toStatus(ctx, "Exchange", err)
+	}
+	return &walletv1.ExchangeResponse{ExchangedAmount: exchanged, Balance: balance}, nil
+}
+
+func (s *walletServer) ListTransactions(ctx context.Context, req *walletv1.ListTransactionsRequest) (*walletv1.ListTransactionsResponse, error) {
+	limit := int(req.GetLimit())
+	if limit == 0 {
+		limit = handlers.DefaultTransactionsLimit
+	}
+	if limit < 0 || limit > handlers.MaxTransactionsLimit {
+		return nil, status.Errorf(codes.InvalidArgument, "limit must be between 1 and %d", handlers.MaxTransactionsLimit)
+	}
+	if req.GetBeforeId() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "before_id must not be negative")
+	}
+
+	transactions, err := s.wallet.Transactions(ctx, principalFrom(ctx).UserID, req.GetBeforeId(), limit)
+	if err != nil {
+		return nil, s.toStatus(ctx, "ListTransactions", err)
+	}
+
+	resp := &walletv1.ListTransactionsResponse{
+		Transactions: make([]*walletv1.Transaction, 0, len(transactions)),
+	}
+	for _, t := range transactions {
+		resp.Transactions = append(resp.Transactions, &walletv1.Transaction{
+			Id:         t.ID,
+			Type:       transactionTypes[t.Type],
+			Currency:   t.Currency,
+			Amount:     t.Amount,
+			ToCurrency: t.ToCurrency,
+			ToAmount:   t.ToAmount,
+			Rate:       t.Rate,
+			Fee:        t.Fee,
+			CreatedAt:  timestamppb.New(t.CreatedAt),
+		})
+	}
+	// Неполная страница означает, что операций больше нет.
+	if len(transactions) > 0 && len(transactions) == limit {
+		resp.NextBeforeId = transactions[len(transactions)-1].ID
+	}
+	return resp, nil
+}
+
+var transactionTypes = map[string]walletv1.TransactionType{
+	storages.TransactionDeposit:  walletv1.TransactionType_TRANSACTION_TYPE_DEPOSIT,
+	storages.TransactionWithdraw: walletv1.TransactionType_TRANSACTION_TYPE_WITHDRAW,
+	storages.TransactionExchange: walletv1.TransactionType_TRANSACTION_TYPE_EXCHANGE,
+}
+
+func unaryLoggingInterceptor(logger *logrus.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		fields := logrus.Fields{
+			"method":   info.FullMethod,
+			"code":     status.Code(err).String(),
+			"duration": time.Since(start),
+		}
+		logger.WithContext(ctx).WithFields(fields).Info("gRPC request completed")
+		return resp, err
+	}
+}
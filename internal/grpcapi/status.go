@@ -0,0 +1,53 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/handlers"
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const errorDomain = "wallet.gw-currency-wallet"
+
+// Значения ErrorInfo.reason, по которым клиент может отличить ошибки с
+// одинаковым кодом.
+const (
+	ReasonInvalidAmount     = "INVALID_AMOUNT"
+	ReasonInsufficientFunds = "INSUFFICIENT_FUNDS"
+	ReasonStepUpRequired    = "STEP_UP_REQUIRED"
+	ReasonInvalidTOTPCode   = "INVALID_TOTP_CODE"
+	ReasonFeatureDisabled   = "FEATURE_DISABLED"
+)
+
+// toStatus переводит ошибки бизнес-правил в коды gRPC. Неизвестные ошибки
+// логируются и отдаются клиенту как Internal без подробностей.
+func (s *walletServer) toStatus(ctx context.Context, method string, err error) error {
+	switch {
+	case errors.Is(err, handlers.ErrInvalidAmount):
+		return withReason(codes.InvalidArgument, "invalid amount or currency", ReasonInvalidAmount)
+	case errors.Is(err, storages.ErrInsufficientFunds):
+		return withReason(codes.FailedPrecondition, "insufficient funds", ReasonInsufficientFunds)
+	case errors.Is(err, handlers.ErrStepUpRequired):
+		return withReason(codes.PermissionDenied, "TOTP code required for this withdrawal", ReasonStepUpRequired)
+	case errors.Is(err, handlers.ErrInvalidTOTPCode):
+		return withReason(codes.PermissionDenied, "invalid TOTP code", ReasonInvalidTOTPCode)
+	case errors.Is(err, handlers.ErrFeatureDisabled):
+		return withReason(codes.Unavailable, "operation is disabled", ReasonFeatureDisabled)
+	}
+
+	s.logger.WithContext(ctx).WithField("method", method).WithError(err).Error("wallet operation failed")
+	return status.Error(codes.Internal, "internal server error")
+}
+
+func withReason(code codes.Code, msg, reason string) error {
+	st := status.New(code, msg)
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{Reason: reason, Domain: errorDomain})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/apierror"
+	"github.com/Krchnk/gw-currency-wallet/internal/credentials"
+	"github.com/Krchnk/gw-currency-wallet/internal/mailer"
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+	"github.com/gin-gonic/gin"
+)
+
+// VerifyEmail подтверждает email по токену из письма.
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req TokenRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	userID, err := h.store.ConsumeUserToken(ctx, storages.TokenPurposeVerifyEmail, hashUserToken(req.Token))
+	if err != nil {
+		if err == storages.ErrTokenInvalid {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeTokenInvalid, "Invalid or expired token")
+			return
+		}
+		h.logger.WithContext(ctx).WithError(err).Error("failed to consume verification token")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	if err := h.store.MarkEmailVerified(ctx, userID); err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to mark email verified")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	h.audit(c, AuditEmailVerified, userID, nil)
+	h.logger.WithContext(ctx).WithField("user_id", userID).Info("email verified")
+	c.JSON(200, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerification повторно отправляет письмо с подтверждением. Ответ
+// не зависит от того, существует ли адрес, чтобы по нему нельзя было
+// перебирать зарегистрированные email.
+func (h *Handler) ResendVerification(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req EmailRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	if user, err := h.store.GetUserByEmail(ctx, req.Email); err == nil && !user.EmailVerified {
+		if err := h.sendVerificationEmail(ctx, user); err != nil {
+			h.logger.WithContext(ctx).WithField("user_id", user.ID).WithError(err).Error("failed to resend verification email")
+		}
+	}
+
+	c.JSON(200, gin.H{"message": "If the email is registered and not verified, a verification link has been sent"})
+}
+
+// ForgotPassword отправляет ссылку для сброса пароля. Как и
+// ResendVerification, всегда отвечает одинаково.
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req EmailRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	if user, err := h.store.GetUserByEmail(ctx, req.Email); err == nil {
+		h.audit(c, AuditPasswordResetRequested, fmt.Sprintf("%d", user.ID), nil)
+		if err := h.sendPasswordResetEmail(ctx, user); err != nil {
+			h.logger.WithContext(ctx).WithField("user_id", user.ID).WithError(err).Error("failed to send password reset email")
+		}
+	}
+
+	c.JSON(200, gin.H{"message": "If the email is registered, a password reset link has been sent"})
+}
+
+// ResetPassword устанавливает новый пароль по токену из письма.
+func (h *Handler) ResetPassword(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req ResetPasswordRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	// Проверяем пароль до того, как погасить токен, чтобы пользователь мог
+	// повторить попытку по той же ссылке.
+	if errs := h.credentials.ValidatePassword("password", req.Password, ""); len(errs) > 0 {
+		apierror.Abort(c, apierror.Validation(errs))
+		return
+	}
+
+	userID, err := h.store.ConsumeUserToken(ctx, storages.TokenPurposePasswordReset, hashUserToken(req.Token))
+	if err != nil {
+		if err == storages.ErrTokenInvalid {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeTokenInvalid, "Invalid or expired token")
+			return
+		}
+		h.logger.WithContext(ctx).WithError(err).Error("failed to consume password reset token")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	passwordHash, err := h.passwords.Hash(req.Password)
+	if err != nil {
+		h.logger.WithContext(ctx).WithError(err).Error("failed to hash password")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	if err := h.store.UpdatePassword(ctx, userID, passwordHash); err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to reset password")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	// Письмо со ссылкой пришло на этот адрес, значит он подтверждён.
+	if err := h.store.MarkEmailVerified(ctx, userID); err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to mark email verified after reset")
+	}
+
+	h.audit(c, AuditPasswordReset, userID, nil)
+	h.logger.WithContext(ctx).WithField("user_id", userID).Info("password reset")
+	c.JSON(200, gin.H{"message": "Password reset successfully"})
+}
+
+// ChangePassword меняет пароль аутентифицированного пользователя. Все
+// сессии отзываются, в ответе возвращается токен новой сессии.
+func (h *Handler) ChangePassword(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req ChangePasswordRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	userID := c.GetString("user_id")
+	h.logger.WithContext(ctx).WithField("user_id", userID).Info("password change attempt")
+
+	user, err := h.store.GetUserByID(ctx, userID)
+	if err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to get user for password change")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	if !h.checkPassword(ctx, user, req.CurrentPassword) {
+		h.logger.WithContext(ctx).WithField("user_id", userID).Error("invalid current password")
+		apierror.Abort(c, apierror.Validation([]credentials.FieldError{{Field: "current_password", Message: "is incorrect"}}))
+		return
+	}
+
+	errs := h.credentials.ValidatePassword("new_password", req.NewPassword, user.Username)
+	if req.NewPassword == req.CurrentPassword {
+		errs = append(errs, credentials.FieldError{Field: "new_password", Message: "must differ from the current password"})
+	}
+	if len(errs) > 0 {
+		apierror.Abort(c, apierror.Validation(errs))
+		return
+	}
+
+	passwordHash, err := h.passwords.Hash(req.NewPassword)
+	if err != nil {
+		h.logger.WithContext(ctx).WithError(err).Error("failed to hash password")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	if err := h.store.UpdatePassword(ctx, userID, passwordHash); err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to change password")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	version, err := h.store.GetTokenVersion(ctx, userID)
+	if err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to get token version")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	token, err := h.issueToken(c, user.ID, version)
+	if err != nil {
+		h.logger.WithContext(ctx).WithError(err).Error("failed to generate JWT")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	h.audit(c, AuditPasswordChanged, userID, nil)
+	h.logger.WithContext(ctx).WithField("user_id", userID).Info("password changed")
+	c.JSON(200, gin.H{"message": "Password changed successfully", "token": token})
+}
+
+func (h *Handler) sendVerificationEmail(ctx context.Context, user storages.User) error {
+	token, err := h.issueUserToken(ctx, user.ID, storages.TokenPurposeVerifyEmail)
+	if err != nil {
+		return err
+	}
+
+	link := h.runtime().account.AppBaseURL + "/verify-email?token=" + url.QueryEscape(token)
+	return h.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email",
+		Body: fmt.Sprintf("Hello, %s!\n\nConfirm your email by opening the link below:\n%s\n\nThe link expires in %s.",
+			user.Username, link, h.runtime().account.VerificationTokenTTL),
+	})
+}
+
+func (h *Handler) sendPasswordResetEmail(ctx context.Context, user storages.User) error {
+	token, err := h.issueUserToken(ctx, user.ID, storages.TokenPurposePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	link := h.runtime().account.AppBaseURL + "/reset-password?token=" + url.QueryEscape(token)
+	return h.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello, %s!\n\nTo set a new password open the link below:\n%s\n\nThe link expires in %s. If you did not request a reset, ignore this email.",
+			user.Username, link, h.runtime().account.PasswordResetTokenTTL),
+	})
+}
+
+// issueUserToken создаёт случайный токен и сохраняет в базе только его хэш.
+func (h *Handler) issueUserToken(ctx context.Context, userID int, purpose string) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	ttl := h.runtime().account.VerificationTokenTTL
+	if purpose == storages.TokenPurposePasswordReset {
+		ttl = h.runtime().account.PasswordResetTokenTTL
+	}
+
+	if err := h.store.CreateUserToken(ctx, fmt.Sprintf("%d", userID), purpose, hashUserToken(token), ttl); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func hashUserToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
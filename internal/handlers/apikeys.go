@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/apierror"
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+	"github.com/Krchnk/gw-currency-wallet/internal/validation"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// Способы аутентификации, значение auth_method в контексте запроса
+const (
+	AuthMethodJWT    = "jwt"
+	AuthMethodAPIKey = "api_key"
+)
+
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// Principal — тот, от чьего имени выполняется запрос: пользователь с JWT
+// или API-ключ пользователя.
+type Principal struct {
+	UserID    string
+	Method    string
+	SessionID string
+	APIKeyID  int
+	Scopes    []string
+}
+
+// HasScope сообщает, разрешена ли область. JWT даёт все права пользователя.
+func (p Principal) HasScope(scope string) bool {
+	return p.Method != AuthMethodAPIKey || hasScope(p.Scopes, scope)
+}
+
+// LogFields — поля журнала, которые добавляются ко всем записям запроса
+// после аутентификации.
+func (p Principal) LogFields() logrus.Fields {
+	fields := logrus.Fields{"user_id": p.UserID, "auth_method": p.Method}
+	if p.Method == AuthMethodAPIKey {
+		fields["api_key_id"] = p.APIKeyID
+	}
+	return fields
+}
+
+// Области действия API-ключей. Шаблон вида "admin:*" покрывает все области
+// с этим префиксом, "*" — все области.
+const (
+	ScopeReadBalance   = "read:balance"
+	ScopeReadRates     = "read:rates"
+	ScopeWriteDeposit  = "write:deposit"
+	ScopeWriteWithdraw = "write:withdraw"
+	ScopeWriteExchange = "write:exchange"
+	ScopeReadWebhooks  = "read:webhooks"
+	ScopeWriteWebhooks = "write:webhooks"
+	ScopeAdminAudit    = "admin:audit"
+)
+
+var knownScopes = map[string]bool{
+	ScopeReadBalance:   true,
+	ScopeReadRates:     true,
+	ScopeWriteDeposit:  true,
+	ScopeWriteWithdraw: true,
+	ScopeWriteExchange: true,
+	ScopeReadWebhooks:  true,
+	ScopeWriteWebhooks: true,
+	ScopeAdminAudit:    true,
+	"read:*":           true,
+	"write:*":          true,
+	"admin:*":          true,
+	"*":                true,
+}
+
+// CreateAPIKey выпускает новый ключ. Ключ целиком возвращается только в
+// этом ответе, в базе остаётся его хэш.
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req CreateAPIKeyRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	var errs []validation.FieldError
+	for i, scope := range req.Scopes {
+		if !knownScopes[scope] {
+			errs = append(errs, validation.FieldError{Field: fmt.Sprintf("scopes[%d]", i), Message: "is not a known scope"})
+		}
+	}
+	if len(errs) > 0 {
+		apierror.Abort(c, apierror.Validation(errs))
+		return
+	}
+
+	userID := c.GetString("user_id")
+
+	prefix, secret, err := generateAPIKey()
+	if err != nil {
+		h.logger.WithContext(ctx).WithError(err).Error("failed to generate api key")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+	rawKey := "gwk_" + prefix + "_" + secret
+
+	key, err := h.store.CreateAPIKey(ctx, storages.APIKey{
+		UserID: userID,
+		Name:   req.Name,
+		Prefix: prefix,
+		Scopes: req.Scopes,
+	}, hashUserToken(rawKey), time.Duration(req.ExpiresInDays)*24*time.Hour)
+	if err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to create api key")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	h.audit(c, AuditAPIKeyCreated, userID, map[string]interface{}{
+		"api_key_id": key.ID,
+		"name":       key.Name,
+		"scopes":     key.Scopes,
+	})
+	h.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"user_id":    userID,
+		"api_key_id": key.ID,
+		"scopes":     key.Scopes,
+	}).Info("api key created")
+	c.JSON(201, gin.H{"api_key": key, "key": rawKey})
+}
+
+func (h *Handler) ListAPIKeys(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := c.GetString("user_id")
+
+	keys, err := h.store.ListAPIKeys(ctx, userID)
+	if err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to list api keys")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	c.JSON(200, gin.H{"api_keys": keys})
+}
+
+func (h *Handler) RevokeAPIKey(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := c.GetString("user_id")
+	keyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid API key id")
+		return
+	}
+
+	if err := h.store.RevokeAPIKey(ctx, userID, keyID); err != nil {
+		if err == storages.ErrAPIKeyNotFound {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "API key not found")
+			return
+		}
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to revoke api key")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	h.audit(c, AuditAPIKeyRevoked, userID, map[string]interface{}{"api_key_id": keyID})
+	h.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"user_id":    userID,
+		"api_key_id": keyID,
+	}).Info("api key revoked")
+	c.JSON(200, gin.H{"message": "API key revoked"})
+}
+
+// RequireScope пропускает запросы по JWT и запросы с API-ключом, у которого
+// есть нужная область.
+func (h *Handler) RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("auth_method") != AuthMethodAPIKey {
+			c.Next()
+			return
+		}
+
+		if !hasScope(c.GetStringSlice("scopes"), scope) {
+			h.logger.WithContext(c.Request.Context()).WithFields(logrus.Fields{
+				"api_key_id": c.GetInt("api_key_id"),
+				"scope":      scope,
+			}).Error("api key lacks required scope")
+			h.auditScopeDenied(c, scope)
+			apierror.Respond(c, http.StatusForbidden, apierror.CodeInsufficientScope, "Insufficient scope")
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireJWT закрывает маршруты управления учётной записью от API-ключей.
+func (h *Handler) RequireJWT() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("auth_method") != AuthMethodJWT {
+			h.logger.WithContext(c.Request.Context()).WithField("api_key_id", c.GetInt("api_key_id")).Error("api key used on user-only route")
+			h.auditScopeDenied(c, "")
+			apierror.Respond(c, http.StatusForbidden, apierror.CodeUserAuthRequired, "This endpoint requires user authentication")
+			return
+		}
+		c.Next()
+	}
+}
+
+func (h *Handler) authenticateAPIKey(ctx context.Context, rawKey string) (Principal, error) {
+	key, err := h.store.AuthenticateAPIKey(ctx, hashUserToken(rawKey))
+	if err != nil {
+		h.logger.WithContext(ctx).WithError(err).Error("invalid api key")
+		return Principal{}, ErrUnauthenticated
+	}
+
+	h.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"user_id":    key.UserID,
+		"api_key_id": key.ID,
+		"api_key":    key.Name,
+	}).Info("api key authenticated")
+	return Principal{
+		UserID:   key.UserID,
+		Method:   AuthMethodAPIKey,
+		APIKeyID: key.ID,
+		Scopes:   key.Scopes,
+	}, nil
+}
+
+// AuditScopeDenied записывает в журнал отказ API-ключу: ключ не даёт
+// области scope (пустая — маршрут только для JWT) для target — маршрута
+// REST или метода gRPC. Ключ и пользователь берутся из AuditActor в ctx.
+func (h *Handler) AuditScopeDenied(ctx context.Context, scope, target string) {
+	actor := storages.AuditActorFrom(ctx)
+	event := storages.AuditEvent{
+		EventType:     AuditAPIKeyScopeDenied,
+		ActorUserID:   actor.UserID,
+		ActorAPIKeyID: actor.APIKeyID,
+		SubjectUserID: actor.UserID,
+		IP:            actor.IP,
+		UserAgent:     actor.UserAgent,
+		Metadata:      map[string]interface{}{"scope": scope, "target": target},
+	}
+	if err := h.store.AppendAuditEvent(ctx, event); err != nil {
+		h.logger.WithContext(ctx).WithField("api_key_id", actor.APIKeyID).WithError(err).Error("failed to write audit event")
+	}
+}
+
+func (h *Handler) auditScopeDenied(c *gin.Context, scope string) {
+	h.audit(c, AuditAPIKeyScopeDenied, c.GetString("user_id"), map[string]interface{}{
+		"scope":  scope,
+		"target": c.Request.Method + " " + c.FullPath(),
+	})
+}
+
+func hasScope(granted []string, required string) bool {
+	for _, scope := range granted {
+		if scope == "*" || scope == required {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(scope, "*"); ok && strings.HasPrefix(required, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// generateAPIKey возвращает публичный префикс для отображения в списке и
+// секретную часть ключа.
+func generateAPIKey() (string, string, error) {
+	raw := make([]byte, 38)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(raw)
+	prefix := strings.NewReplacer("-", "a", "_", "b").Replace(encoded[:8])
+	return prefix, encoded[8:], nil
+}
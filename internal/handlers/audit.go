@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/apierror"
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Типы событий журнала аудита. События об операциях с деньгами
+// (storages.AuditDeposit и др.) пишет хранилище.
+const (
+	AuditUserRegistered         = "user.registered"
+	AuditLoginSucceeded         = "auth.login_succeeded"
+	AuditLoginFailed            = "auth.login_failed"
+	AuditSecondFactorFailed     = "auth.second_factor_failed"
+	AuditTokenRefreshed         = "auth.token_refreshed"
+	AuditEmailVerified          = "auth.email_verified"
+	AuditPasswordChanged        = "auth.password_changed"
+	AuditPasswordResetRequested = "auth.password_reset_requested"
+	AuditPasswordReset          = "auth.password_reset"
+	AuditTOTPEnabled            = "auth.2fa_enabled"
+	AuditTOTPDisabled           = "auth.2fa_disabled"
+	AuditSessionRevoked         = "session.revoked"
+	AuditOtherSessionsRevoked   = "session.others_revoked"
+	AuditAPIKeyCreated          = "api_key.created"
+	AuditAPIKeyRevoked          = "api_key.revoked"
+	AuditAPIKeyScopeDenied      = "api_key.scope_denied"
+	AuditWebhookCreated         = "webhook.created"
+	AuditWebhookDeleted         = "webhook.deleted"
+	AuditWebhookReplayed        = "webhook.replayed"
+	AuditAdminAuditLogViewed    = "admin.audit_log_viewed"
+	AuditAdminAuditLogVerified  = "admin.audit_log_verified"
+)
+
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 200
+)
+
+// GetMyAuditLog возвращает события по учётной записи текущего пользователя.
+func (h *Handler) GetMyAuditLog(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	filter, ok := auditFilterFromQuery(c)
+	if !ok {
+		return
+	}
+	filter.SubjectUserID = c.GetString("user_id")
+
+	events, err := h.store.ListAuditEvents(ctx, filter)
+	if err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", filter.SubjectUserID).WithError(err).Error("failed to list audit events")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	c.JSON(200, gin.H{"events": events})
+}
+
+// AdminListAuditLog возвращает журнал целиком, с фильтрами user_id и event_type.
+func (h *Handler) AdminListAuditLog(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	filter, ok := auditFilterFromQuery(c)
+	if !ok {
+		return
+	}
+	filter.SubjectUserID = c.Query("user_id")
+	if filter.SubjectUserID != "" {
+		if _, err := strconv.Atoi(filter.SubjectUserID); err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid user_id")
+			return
+		}
+	}
+
+	events, err := h.store.ListAuditEvents(ctx, filter)
+	if err != nil {
+		h.logger.WithContext(ctx).WithError(err).Error("failed to list audit events")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	h.audit(c, AuditAdminAuditLogViewed, filter.SubjectUserID, map[string]interface{}{
+		"event_type": filter.EventType,
+		"before_id":  filter.BeforeID,
+		"limit":      filter.Limit,
+	})
+	c.JSON(200, gin.H{"events": events})
+}
+
+// AdminVerifyAuditLog проверяет целостность цепочки хэшей журнала.
+func (h *Handler) AdminVerifyAuditLog(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	checked, err := h.store.VerifyAuditChain(ctx)
+	if err != nil && !errors.Is(err, storages.ErrAuditChainBroken) {
+		h.logger.WithContext(ctx).WithError(err).Error("failed to verify audit log")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	valid := err == nil
+	h.audit(c, AuditAdminAuditLogVerified, "", map[string]interface{}{
+		"checked": checked,
+		"valid":   valid,
+	})
+
+	response := gin.H{"valid": valid, "checked": checked}
+	if !valid {
+		response["error"] = err.Error()
+	}
+	c.JSON(200, response)
+}
+
+// RequireAdmin пропускает только администраторов. API-ключ администратора
+// дополнительно должен иметь область admin:audit.
+func (h *Handler) RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		userID := c.GetString("user_id")
+		user, err := h.store.GetUserByID(ctx, userID)
+		if err != nil || !user.IsAdmin {
+			h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("admin access denied")
+			apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Forbidden")
+			return
+		}
+
+		if c.GetString("auth_method") == AuthMethodAPIKey && !hasScope(c.GetStringSlice("scopes"), ScopeAdminAudit) {
+			h.logger.WithContext(ctx).WithField("api_key_id", c.GetInt("api_key_id")).Error("api key lacks admin scope")
+			h.auditScopeDenied(c, ScopeAdminAudit)
+			apierror.Respond(c, http.StatusForbidden, apierror.CodeInsufficientScope, "Insufficient scope")
+			return
+		}
+		c.Next()
+	}
+}
+
+// audit записывает событие в журнал. Инициатор, IP и user agent берутся из
+// запроса; ошибка записи логируется и не прерывает обработку запроса.
+func (h *Handler) audit(c *gin.Context, eventType, subjectUserID string, metadata map[string]interface{}) {
+	ctx := c.Request.Context()
+
+	event := storages.AuditEvent{
+		EventType:     eventType,
+		ActorUserID:   c.GetString("user_id"),
+		ActorAPIKeyID: c.GetInt("api_key_id"),
+		SubjectUserID: subjectUserID,
+		IP:            c.ClientIP(),
+		UserAgent:     c.Request.UserAgent(),
+		Metadata:      metadata,
+	}
+
+	if err := h.store.AppendAuditEvent(ctx, event); err != nil {
+		h.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"event_type":      eventType,
+			"subject_user_id": subjectUserID,
+		}).WithError(err).Error("failed to write audit event")
+	}
+}
+
+func auditFilterFromQuery(c *gin.Context) (storages.AuditFilter, bool) {
+	filter := storages.AuditFilter{
+		EventType: c.Query("event_type"),
+		Limit:     defaultAuditLimit,
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed <= 0 || parsed > maxAuditLimit {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid limit")
+			return filter, false
+		}
+		filter.Limit = parsed
+	}
+
+	if beforeID := c.Query("before_id"); beforeID != "" {
+		parsed, err := strconv.ParseInt(beforeID, 10, 64)
+		if err != nil || parsed <= 0 {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid before_id")
+			return filter, false
+		}
+		filter.BeforeID = parsed
+	}
+
+	return filter, true
+}
@@ -4,123 +4,209 @@ import (
 	"context"
 	"fmt"
 	"github.com/Krchnk/currency-wallet-proto/exchangerates"
+	"github.com/Krchnk/gw-currency-wallet/internal/apierror"
 	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"github.com/Krchnk/gw-currency-wallet/internal/credentials"
+	"github.com/Krchnk/gw-currency-wallet/internal/logging"
+	"github.com/Krchnk/gw-currency-wallet/internal/mailer"
+	"github.com/Krchnk/gw-currency-wallet/internal/metrics"
+	"github.com/Krchnk/gw-currency-wallet/internal/password"
 	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+	"github.com/Krchnk/gw-currency-wallet/internal/stream"
+	"github.com/Krchnk/gw-currency-wallet/internal/totp"
+	"github.com/Krchnk/gw-currency-wallet/internal/validation"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 	"github.com/patrickmn/go-cache"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/crypto/bcrypt"
 
 	"net/http"
-	"os"
+	"strconv"
+	"sync/atomic"
 	"time"
 )
 
-var logger = logrus.New()
-
-func init() {
-	logger.SetFormatter(&logrus.JSONFormatter{})
-	if lvl, err := logrus.ParseLevel(os.Getenv("LOG_LEVEL")); err == nil {
-		logger.SetLevel(lvl)
-	} else {
-		logger.SetLevel(logrus.InfoLevel)
-	}
-}
-
 type Handler struct {
 	store               storages.Storage
 	cfg                 config.Config
 	cache               *cache.Cache
 	exchangeRatesClient exchangerates.ExchangeRatesServiceClient
+	cipher              *totp.Cipher // шифрует секреты TOTP и вебхуков
+	mailer              mailer.Mailer
+	credentials         *credentials.Policy
+	passwords           *password.Hasher
+	stream              *stream.Hub
+	settings            atomic.Pointer[runtimeSettings]
+	logger              *logrus.Logger
+}
+
+// runtimeSettings — настройки, которые меняются без перезапуска через Reload.
+type runtimeSettings struct {
+	account         config.AccountConfig
+	stepUpThreshold float64
+	rateCacheTTL    time.Duration
+	fees            config.FeesConfig
+	features        config.FeaturesConfig
 }
 
-func NewHandler(store storages.Storage, cfg config.Config, exchangeRatesClient exchangerates.ExchangeRatesServiceClient) *Handler {
-	return &Handler{
+func NewHandler(store storages.Storage, cfg config.Config, exchangeRatesClient exchangerates.ExchangeRatesServiceClient, mail mailer.Mailer, policy *credentials.Policy, hasher *password.Hasher, hub *stream.Hub, logger *logrus.Logger) *Handler {
+	h := &Handler{
 		store:               store,
 		cfg:                 cfg,
 		cache:               cache.New(5*time.Minute, 10*time.Minute),
 		exchangeRatesClient: exchangeRatesClient,
+		cipher:              totp.NewCipher(cfg.EncryptionKey()),
+		mailer:              mail,
+		credentials:         policy,
+		passwords:           hasher,
+		stream:              hub,
+		logger:              logger,
 	}
+	h.Reload(cfg)
+	return h
+}
+
+// Reload применяет новые значения настроек, которые можно менять на лету.
+func (h *Handler) Reload(cfg config.Config) {
+	h.settings.Store(&runtimeSettings{
+		account:         cfg.Account,
+		stepUpThreshold: cfg.TOTP.StepUpThreshold,
+		rateCacheTTL:    cfg.ExchangeRates.CacheTTL,
+		fees:            cfg.Fees,
+		features:        cfg.Features,
+	})
+}
+
+func (h *Handler) runtime() *runtimeSettings {
+	return h.settings.Load()
 }
 
 func (h *Handler) Register(c *gin.Context) {
-	var req struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-		Email    string `json:"email"`
-	}
+	ctx := c.Request.Context()
 
-	if err := c.BindJSON(&req); err != nil {
-		logger.WithError(err).Error("failed to bind registration request")
-		c.JSON(400, gin.H{"error": "Invalid request"})
+	var req RegisterRequest
+	if !h.bindJSON(c, &req) {
 		return
 	}
 
-	logger.WithFields(logrus.Fields{
+	h.logger.WithContext(ctx).WithFields(logrus.Fields{
 		"username": req.Username,
 		"email":    req.Email,
 	}).Info("registration attempt")
 
-	err := h.store.RegisterUser(req.Username, req.Password, req.Email)
+	if errs := h.credentials.ValidateRegistration(req.Username, req.Password, req.Email); len(errs) > 0 {
+		h.logger.WithContext(ctx).WithField("username", req.Username).Error("registration rejected by credential policy")
+		apierror.Abort(c, apierror.Validation(errs))
+		return
+	}
+
+	passwordHash, err := h.passwords.Hash(req.Password)
 	if err != nil {
-		logger.WithFields(logrus.Fields{
+		h.logger.WithContext(ctx).WithError(err).Error("failed to hash password")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	err = h.store.RegisterUser(ctx, req.Username, passwordHash, req.Email)
+	if err != nil {
+		h.logger.WithContext(ctx).WithFields(logrus.Fields{
 			"username": req.Username,
 			"email":    req.Email,
 		}).WithError(err).Error("user registration failed")
-		c.JSON(400, gin.H{"error": "Username or email already exists"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeAlreadyExists, "Username or email already exists")
 		return
 	}
 
-	logger.WithField("username", req.Username).Info("user registered successfully")
+	user, err := h.store.GetUser(ctx, req.Username)
+	if err != nil {
+		h.logger.WithContext(ctx).WithField("username", req.Username).WithError(err).Error("failed to load registered user")
+	} else {
+		h.audit(c, AuditUserRegistered, fmt.Sprintf("%d", user.ID), map[string]interface{}{"username": user.Username})
+		if err := h.sendVerificationEmail(ctx, user); err != nil {
+			// Регистрация уже прошла, письмо можно запросить повторно.
+			h.logger.WithContext(ctx).WithField("username", req.Username).WithError(err).Error("failed to send verification email")
+		}
+	}
+
+	h.logger.WithContext(ctx).WithField("username", req.Username).Info("user registered successfully")
 	c.JSON(201, gin.H{"message": "User registered successfully"})
 }
 
 func (h *Handler) Login(c *gin.Context) {
-	var req struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
+	ctx := c.Request.Context()
+
+	var req LoginRequest
+	if !h.bindJSON(c, &req) {
+		return
 	}
 
-	if err := c.BindJSON(&req); err != nil {
-		logger.WithError(err).Error("failed to bind login request")
-		c.JSON(400, gin.H{"error": "Invalid request"})
+	h.logger.WithContext(ctx).WithField("username", req.Username).Info("login attempt")
+
+	user, err := h.store.GetUser(ctx, req.Username)
+	if err != nil || !h.checkPassword(ctx, user, req.Password) {
+		subjectID := ""
+		if err == nil {
+			subjectID = fmt.Sprintf("%d", user.ID)
+		}
+		h.audit(c, AuditLoginFailed, subjectID, map[string]interface{}{"username": req.Username, "reason": "invalid_credentials"})
+		h.logger.WithContext(ctx).WithField("username", req.Username).Error("invalid username or password")
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid username or password")
+		return
+	}
+
+	if h.runtime().account.EmailVerificationRequired && !user.EmailVerified {
+		h.audit(c, AuditLoginFailed, fmt.Sprintf("%d", user.ID), map[string]interface{}{"username": req.Username, "reason": "email_not_verified"})
+		h.logger.WithContext(ctx).WithField("username", req.Username).Error("login rejected, email not verified")
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeEmailNotVerified, "Email not verified")
 		return
 	}
 
-	logger.WithField("username", req.Username).Info("login attempt")
+	enrolled, err := h.totpEnabled(ctx, fmt.Sprintf("%d", user.ID))
+	if err != nil {
+		h.logger.WithContext(ctx).WithError(err).Error("failed to check totp enrollment")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+	if enrolled {
+		mfaToken, err := h.generateMFAToken(ctx, user.ID)
+		if err != nil {
+			h.logger.WithContext(ctx).WithError(err).Error("failed to generate MFA token")
+			apierror.Abort(c, apierror.Internal(err))
+			return
+		}
 
-	user, err := h.store.GetUser(req.Username)
-	if err != nil || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
-		logger.WithField("username", req.Username).Error("invalid username or password")
-		c.JSON(401, gin.H{"error": "Invalid username or password"})
+		h.logger.WithContext(ctx).WithField("username", req.Username).Info("password accepted, second factor required")
+		c.JSON(200, gin.H{"mfa_required": true, "mfa_token": mfaToken})
 		return
 	}
 
-	token, err := h.generateJWT(user.ID)
+	token, err := h.issueToken(c, user.ID, user.TokenVersion)
 	if err != nil {
-		logger.WithError(err).Error("failed to generate JWT")
-		c.JSON(500, gin.H{"error": "Internal server error"})
+		h.logger.WithContext(ctx).WithError(err).Error("failed to generate JWT")
+		apierror.Abort(c, apierror.Internal(err))
 		return
 	}
 
-	logger.WithField("username", req.Username).Info("login successful")
+	h.audit(c, AuditLoginSucceeded, fmt.Sprintf("%d", user.ID), map[string]interface{}{"second_factor": false})
+	h.logger.WithContext(ctx).WithField("username", req.Username).Info("login successful")
 	c.JSON(200, gin.H{"token": token})
 }
 
 func (h *Handler) GetBalance(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	userID := c.GetString("user_id")
 
-	logger.WithField("user_id", userID).Info("getting balance")
+	h.logger.WithContext(ctx).WithField("user_id", userID).Info("getting balance")
 
-	balance, err := h.store.GetBalance(userID)
+	balance, err := h.Balance(ctx, userID)
 	if err != nil {
-		logger.WithField("user_id", userID).WithError(err).Error("failed to get balance")
-		c.JSON(500, gin.H{"error": "Failed to retrieve balance"})
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to get balance")
+		apierror.Abort(c, apierror.New(http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve balance").WithCause(err))
 		return
 	}
 
-	logger.WithFields(logrus.Fields{
+	h.logger.WithContext(ctx).WithFields(logrus.Fields{
 		"user_id": userID,
 		"balance": balance,
 	}).Info("balance retrieved")
@@ -128,42 +214,40 @@ func (h *Handler) GetBalance(c *gin.Context) {
 }
 
 func (h *Handler) Deposit(c *gin.Context) {
-	var req struct {
-		Amount   float64 `json:"amount"`
-		Currency string  `json:"currency"`
-	}
+	ctx := c.Request.Context()
 
-	if err := c.BindJSON(&req); err != nil {
-		logger.WithError(err).Error("failed to bind deposit request")
-		c.JSON(400, gin.H{"error": "Invalid request"})
+	var req DepositRequest
+	if !h.bindJSON(c, &req) {
 		return
 	}
 
 	userID := c.GetString("user_id")
-	logger.WithFields(logrus.Fields{
+	h.logger.WithContext(ctx).WithFields(logrus.Fields{
 		"user_id":  userID,
-		"amount":   req.Amount,
+		"amount":   *req.Amount,
 		"currency": req.Currency,
 	}).Info("deposit attempt")
 
-	if req.Amount <= 0 || !isValidCurrency(req.Currency) {
-		logger.WithFields(logrus.Fields{
-			"amount":   req.Amount,
+	balance, err := h.DepositFunds(ctx, userID, req.Currency, *req.Amount)
+	if err == ErrInvalidAmount {
+		h.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"amount":   *req.Amount,
 			"currency": req.Currency,
 		}).Error("invalid amount or currency")
-		c.JSON(400, gin.H{"error": "Invalid amount or currency"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidAmount, "Invalid amount or currency")
+		return
+	}
+	if err == ErrFeatureDisabled {
+		respondFeatureDisabled(c)
 		return
 	}
-
-	err := h.store.Deposit(userID, req.Currency, req.Amount)
 	if err != nil {
-		logger.WithError(err).Error("deposit failed")
-		c.JSON(500, gin.H{"error": "Failed to deposit"})
+		h.logger.WithContext(ctx).WithError(err).Error("deposit failed")
+		apierror.Abort(c, apierror.New(http.StatusInternalServerError, apierror.CodeInternal, "Failed to deposit").WithCause(err))
 		return
 	}
 
-	balance, _ := h.store.GetBalance(userID)
-	logger.WithFields(logrus.Fields{
+	h.logger.WithContext(ctx).WithFields(logrus.Fields{
 		"user_id": userID,
 		"balance": balance,
 	}).Info("deposit successful")
@@ -174,42 +258,52 @@ func (h *Handler) Deposit(c *gin.Context) {
 }
 
 func (h *Handler) Withdraw(c *gin.Context) {
-	var req struct {
-		Amount   float64 `json:"amount"`
-		Currency string  `json:"currency"`
-	}
+	ctx := c.Request.Context()
 
-	if err := c.BindJSON(&req); err != nil {
-		logger.WithError(err).Error("failed to bind withdraw request")
-		c.JSON(400, gin.H{"error": "Invalid request"})
+	var req WithdrawRequest
+	if !h.bindJSON(c, &req) {
 		return
 	}
 
 	userID := c.GetString("user_id")
-	logger.WithFields(logrus.Fields{
+	h.logger.WithContext(ctx).WithFields(logrus.Fields{
 		"user_id":  userID,
-		"amount":   req.Amount,
+		"amount":   *req.Amount,
 		"currency": req.Currency,
 	}).Info("withdraw attempt")
 
-	if req.Amount <= 0 || !isValidCurrency(req.Currency) {
-		logger.WithFields(logrus.Fields{
-			"amount":   req.Amount,
+	balance, err := h.WithdrawFunds(ctx, userID, req.Currency, *req.Amount, req.TOTPCode)
+	switch err {
+	case nil:
+	case ErrInvalidAmount:
+		h.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"amount":   *req.Amount,
 			"currency": req.Currency,
 		}).Error("invalid amount or currency")
-		c.JSON(400, gin.H{"error": "Invalid amount or currency"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidAmount, "Invalid amount or currency")
 		return
-	}
-
-	err := h.store.Withdraw(userID, req.Currency, req.Amount)
-	if err != nil {
-		logger.WithError(err).Error("withdraw failed")
-		c.JSON(400, gin.H{"error": "Insufficient funds or invalid amount"})
+	case ErrFeatureDisabled:
+		respondFeatureDisabled(c)
+		return
+	case ErrStepUpRequired:
+		h.logger.WithContext(ctx).WithField("user_id", userID).Error("withdraw requires TOTP code")
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeStepUpRequired, "TOTP code required for this withdrawal")
+		return
+	case ErrInvalidTOTPCode:
+		h.logger.WithContext(ctx).WithField("user_id", userID).Error("invalid TOTP code for withdraw")
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeInvalidTOTPCode, "Invalid TOTP code")
+		return
+	case storages.ErrInsufficientFunds:
+		h.logger.WithContext(ctx).WithError(err).Error("withdraw failed")
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInsufficientFunds, "Insufficient funds")
+		return
+	default:
+		h.logger.WithContext(ctx).WithError(err).Error("withdraw failed")
+		apierror.Abort(c, apierror.Internal(err))
 		return
 	}
 
-	balance, _ := h.store.GetBalance(userID)
-	logger.WithFields(logrus.Fields{
+	h.logger.WithContext(ctx).WithFields(logrus.Fields{
 		"user_id": userID,
 		"balance": balance,
 	}).Info("withdraw successful")
@@ -221,15 +315,15 @@ func (h *Handler) Withdraw(c *gin.Context) {
 
 func (h *Handler) GetRates(c *gin.Context) {
 	userID := c.GetString("user_id")
-	logger.WithField("user_id", userID).Info("getting exchange rates")
+	h.logger.WithContext(c.Request.Context()).WithField("user_id", userID).Info("getting exchange rates")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
 
 	resp, err := h.exchangeRatesClient.GetExchangeRates(ctx, &exchangerates.GetExchangeRatesRequest{})
 	if err != nil {
-		logger.WithError(err).Error("failed to get exchange rates from gRPC service")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve exchange rates"})
+		h.logger.WithContext(ctx).WithError(err).Error("failed to get exchange rates from gRPC service")
+		apierror.Abort(c, apierror.New(http.StatusInternalServerError, apierror.CodeRatesUnavailable, "Failed to retrieve exchange rates").WithCause(err))
 		return
 	}
 
@@ -240,7 +334,7 @@ func (h *Handler) GetRates(c *gin.Context) {
 		}
 	}
 
-	logger.WithFields(logrus.Fields{
+	h.logger.WithContext(ctx).WithFields(logrus.Fields{
 		"user_id": userID,
 		"rates":   rates,
 	}).Info("exchange rates retrieved")
@@ -248,121 +342,230 @@ func (h *Handler) GetRates(c *gin.Context) {
 }
 
 func (h *Handler) Exchange(c *gin.Context) {
-	var req struct {
-		FromCurrency string  `json:"from_currency"`
-		ToCurrency   string  `json:"to_currency"`
-		Amount       float64 `json:"amount"`
-	}
+	ctx := c.Request.Context()
 
-	if err := c.BindJSON(&req); err != nil {
-		logger.WithError(err).Error("failed to bind exchange request")
-		c.JSON(400, gin.H{"error": "Invalid request"})
+	var req ExchangeRequest
+	if !h.bindJSON(c, &req) {
 		return
 	}
 
 	userID := c.GetString("user_id")
-	logger.WithFields(logrus.Fields{
+	h.logger.WithContext(ctx).WithFields(logrus.Fields{
 		"user_id": userID,
 		"from":    req.FromCurrency,
 		"to":      req.ToCurrency,
-		"amount":  req.Amount,
+		"amount":  *req.Amount,
 	}).Info("exchange request initiated")
 
-	if !isValidCurrency(req.FromCurrency) || !isValidCurrency(req.ToCurrency) || req.Amount <= 0 {
-		logger.WithFields(logrus.Fields{
+	exchanged, balance, err := h.ExchangeFunds(ctx, userID, req.FromCurrency, req.ToCurrency, *req.Amount)
+	switch err {
+	case nil:
+	case ErrInvalidAmount:
+		h.logger.WithContext(ctx).WithFields(logrus.Fields{
 			"from":   req.FromCurrency,
 			"to":     req.ToCurrency,
 			"amount": req.Amount,
 		}).Error("invalid currencies or amount")
-		c.JSON(400, gin.H{"error": "Invalid currencies or amount"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidAmount, "Invalid currencies or amount")
 		return
-	}
-
-	rate, err := h.getExchangeRate(req.FromCurrency, req.ToCurrency)
-	if err != nil {
-		logger.WithError(err).Error("failed to get exchange rate")
-		c.JSON(500, gin.H{"error": "Failed to get exchange rate"})
+	case ErrFeatureDisabled:
+		respondFeatureDisabled(c)
 		return
-	}
-
-	if err := h.store.Exchange(userID, req.FromCurrency, req.ToCurrency, req.Amount, rate); err != nil {
-		logger.WithError(err).Error("exchange operation failed")
-		c.JSON(400, gin.H{"error": "Insufficient funds or invalid currencies"})
+	case storages.ErrInsufficientFunds:
+		h.logger.WithContext(ctx).WithError(err).Error("exchange operation failed")
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInsufficientFunds, "Insufficient funds")
+		return
+	default:
+		h.logger.WithContext(ctx).WithError(err).Error("exchange operation failed")
+		apierror.Abort(c, apierror.New(http.StatusInternalServerError, apierror.CodeInternal, "Failed to exchange currency").WithCause(err))
 		return
 	}
 
-	balance, _ := h.store.GetBalance(userID)
-	logger.WithFields(logrus.Fields{
+	h.logger.WithContext(ctx).WithFields(logrus.Fields{
 		"user_id": userID,
 		"balance": balance,
 	}).Info("exchange completed successfully")
 
 	c.JSON(200, gin.H{
 		"message":          "Exchange successful",
-		"exchanged_amount": req.Amount * rate,
+		"exchanged_amount": exchanged,
 		"new_balance":      balance,
 	})
 }
 
-func (h *Handler) AuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		tokenStr := c.GetHeader("Authorization")
-		if tokenStr == "" || len(tokenStr) < 7 || tokenStr[:7] != "Bearer " {
-			logger.Error("missing or invalid Authorization header")
-			c.JSON(401, gin.H{"error": "Unauthorized"})
-			c.Abort()
+// GetTransactions возвращает историю операций с курсором before_id.
+func (h *Handler) GetTransactions(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := c.GetString("user_id")
+
+	limit := DefaultTransactionsLimit
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 || parsed > MaxTransactionsLimit {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid limit")
 			return
 		}
+		limit = parsed
+	}
 
-		tokenStr = tokenStr[7:]
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method")
-			}
-			return []byte(h.cfg.JWTSecret), nil
-		})
+	var beforeID int64
+	if raw := c.Query("before_id"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed <= 0 {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid before_id")
+			return
+		}
+		beforeID = parsed
+	}
+
+	transactions, err := h.Transactions(ctx, userID, beforeID, limit)
+	if err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to list transactions")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	c.JSON(200, gin.H{"transactions": transactions})
+}
 
-		if err != nil || !token.Valid {
-			logger.WithError(err).Error("invalid JWT token")
-			c.JSON(401, gin.H{"error": "Unauthorized"})
-			c.Abort()
+// AuthMiddleware принимает либо Bearer JWT, либо API-ключ в заголовке X-API-Key.
+func (h *Handler) AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, err := h.Authenticate(c.Request.Context(), c.GetHeader("Authorization"), c.GetHeader(apiKeyHeader))
+		if err != nil {
+			apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized")
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			userID := claims["user_id"].(string)
-			c.Set("user_id", userID)
-			logger.WithField("user_id", userID).Info("user authenticated")
-			c.Next()
+		c.Set("user_id", principal.UserID)
+		c.Set("auth_method", principal.Method)
+		if principal.Method == AuthMethodAPIKey {
+			c.Set("api_key_id", principal.APIKeyID)
+			c.Set("scopes", principal.Scopes)
 		} else {
-			logger.Error("failed to parse JWT claims")
-			c.JSON(401, gin.H{"error": "Unauthorized"})
-			c.Abort()
+			c.Set("session_id", principal.SessionID)
 		}
+		ctx := logging.WithFields(c.Request.Context(), principal.LogFields())
+		ctx = storages.WithAuditActor(ctx, storages.AuditActor{
+			UserID:    principal.UserID,
+			APIKeyID:  principal.APIKeyID,
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		})
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
 	}
 }
 
-func (h *Handler) getExchangeRate(from, to string) (float64, error) {
+// Authenticate проверяет значение заголовка Authorization ("Bearer <JWT>")
+// или API-ключ. Если передан ключ, заголовок Authorization не смотрится.
+func (h *Handler) Authenticate(ctx context.Context, authorization, apiKey string) (Principal, error) {
+	if apiKey != "" {
+		return h.authenticateAPIKey(ctx, apiKey)
+	}
+
+	if authorization == "" || len(authorization) < 7 || authorization[:7] != "Bearer " {
+		h.logger.WithContext(ctx).Error("missing or invalid Authorization header")
+		return Principal{}, ErrUnauthenticated
+	}
+
+	claims, err := h.parseToken(authorization[7:])
+	if err != nil {
+		h.logger.WithContext(ctx).WithError(err).Error("invalid JWT token")
+		return Principal{}, ErrUnauthenticated
+	}
+
+	// Токены с purpose (например, промежуточный токен 2FA) не дают доступа к API.
+	userID, ok := claims["user_id"].(string)
+	if _, hasPurpose := claims["purpose"]; hasPurpose || !ok {
+		h.logger.WithContext(ctx).Error("JWT token is not an access token")
+		return Principal{}, ErrUnauthenticated
+	}
+
+	// Токен действителен, пока жива его сессия и не сменился пароль
+	// (смена пароля увеличивает token_version).
+	sessionID, _ := claims["sid"].(string)
+	tokenVersion, _ := claims["tv"].(float64)
+	if err := h.store.ValidateSession(ctx, sessionID, userID, int(tokenVersion)); err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("JWT session invalid or revoked")
+		return Principal{}, ErrUnauthenticated
+	}
+
+	h.logger.WithContext(ctx).WithField("user_id", userID).Info("user authenticated")
+	return Principal{UserID: userID, Method: AuthMethodJWT, SessionID: sessionID}, nil
+}
+
+func (h *Handler) parseToken(tokenStr string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method")
+		}
+		return []byte(h.cfg.JWTSecret), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse JWT claims")
+	}
+	return claims, nil
+}
+
+// checkPassword проверяет пароль и, если сохранённый хэш посчитан устаревшим
+// алгоритмом или с другими параметрами, пересчитывает его.
+func (h *Handler) checkPassword(ctx context.Context, user storages.User, plain string) bool {
+	ok, needsRehash, err := h.passwords.Verify(plain, user.PasswordHash)
+	if err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", user.ID).WithError(err).Error("failed to verify password hash")
+		return false
+	}
+	if !ok || !needsRehash {
+		return ok
+	}
+
+	newHash, err := h.passwords.Hash(plain)
+	if err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", user.ID).WithError(err).Error("failed to rehash password")
+		return true
+	}
+	if err := h.store.UpgradePasswordHash(ctx, fmt.Sprintf("%d", user.ID), user.PasswordHash, newHash); err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", user.ID).WithError(err).Error("failed to store upgraded password hash")
+		return true
+	}
+
+	h.logger.WithContext(ctx).WithField("user_id", user.ID).Info("password hash upgraded")
+	return true
+}
+
+func (h *Handler) getExchangeRate(ctx context.Context, from, to string) (float64, error) {
 	cacheKey := from + "_" + to
 	if cached, found := h.cache.Get(cacheKey); found {
-		logger.WithFields(logrus.Fields{
+		metrics.RateCacheHit()
+		h.logger.WithContext(ctx).WithFields(logrus.Fields{
 			"from": from,
 			"to":   to,
 		}).Info("rate retrieved from cache")
 		return cached.(float64), nil
 	}
+	metrics.RateCacheMiss()
 
-	rate, err := h.store.GetExchangeRate(from, to)
+	rate, err := h.store.GetExchangeRate(ctx, from, to)
 	if err != nil {
-		logger.WithFields(logrus.Fields{
+		h.logger.WithContext(ctx).WithFields(logrus.Fields{
 			"from": from,
 			"to":   to,
 		}).WithError(err).Error("failed to get rate from database")
 		return 0, err
 	}
 
-	h.cache.Set(cacheKey, rate, 5*time.Minute)
-	logger.WithFields(logrus.Fields{
+	h.cache.Set(cacheKey, rate, h.runtime().rateCacheTTL)
+	h.logger.WithContext(ctx).WithFields(logrus.Fields{
 		"from": from,
 		"to":   to,
 		"rate": rate,
@@ -370,15 +573,21 @@ func (h *Handler) getExchangeRate(from, to string) (float64, error) {
 	return rate, nil
 }
 
-func (h *Handler) generateJWT(userID int) (string, error) {
+func (h *Handler) generateJWT(userID, tokenVersion int, session storages.Session) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"user_id": fmt.Sprintf("%d", userID),
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+		"tv":      tokenVersion,
+		"sid":     session.ID,
+		"exp":     session.ExpiresAt.Unix(),
 	})
 	return token.SignedString([]byte(h.cfg.JWTSecret))
 }
 
+// respondFeatureDisabled отвечает на операцию, выключенную в features.
+func respondFeatureDisabled(c *gin.Context) {
+	apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeFeatureDisabled, "This operation is temporarily disabled")
+}
+
 func isValidCurrency(currency string) bool {
-	validCurrencies := map[string]bool{"USD": true, "RUB": true, "EUR": true}
-	return validCurrencies[currency]
+	return validation.IsCurrency(currency)
 }
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"github.com/Krchnk/gw-currency-wallet/internal/apierror"
+	"github.com/Krchnk/gw-currency-wallet/internal/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// Тела запросов REST API. Теги binding проверяются в bindJSON; правила
+// политики учётных данных (длина пароля, формат имени) проверяются отдельно
+// в credentials.Policy, потому что зависят от конфигурации.
+
+type RegisterRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Email    string `json:"email" binding:"required"`
+}
+
+type LoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// Суммы — указатели, чтобы отличить отсутствующее поле от нуля.
+
+type DepositRequest struct {
+	Amount   *float64 `json:"amount" binding:"required,money"`
+	Currency string   `json:"currency" binding:"required,currency"`
+}
+
+type WithdrawRequest struct {
+	Amount   *float64 `json:"amount" binding:"required,money"`
+	Currency string   `json:"currency" binding:"required,currency"`
+	TOTPCode string   `json:"totp_code"`
+}
+
+type ExchangeRequest struct {
+	FromCurrency string   `json:"from_currency" binding:"required,currency"`
+	ToCurrency   string   `json:"to_currency" binding:"required,currency"`
+	Amount       *float64 `json:"amount" binding:"required,money"`
+}
+
+type TokenRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type EmailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// SecondFactorRequest принимает TOTP-код или код восстановления.
+type SecondFactorRequest struct {
+	Code         string `json:"code" binding:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code" binding:"required_without=Code"`
+}
+
+type LoginTOTPRequest struct {
+	MFAToken     string `json:"mfa_token" binding:"required"`
+	Code         string `json:"code" binding:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code" binding:"required_without=Code"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"min=0"`
+}
+
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" binding:"required,max=2048"`
+	Events []string `json:"events" binding:"required,min=1"`
+}
+
+// bindJSON разбирает и проверяет тело запроса. При ошибке отвечает 400 со
+// списком полей и возвращает false.
+func (h *Handler) bindJSON(c *gin.Context, req interface{}) bool {
+	errs := validation.BindJSON(c, req)
+	if len(errs) == 0 {
+		return true
+	}
+
+	h.logger.WithContext(c.Request.Context()).WithField("fields", errs).Error("request validation failed")
+	apierror.Abort(c, apierror.Validation(errs))
+	return false
+}
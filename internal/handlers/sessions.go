@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/apierror"
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+	"github.com/gin-gonic/gin"
+)
+
+const sessionTTL = 24 * time.Hour
+
+// ListSessions возвращает активные сессии пользователя; текущая отмечена
+// полем current.
+func (h *Handler) ListSessions(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := c.GetString("user_id")
+
+	sessions, err := h.store.ListSessions(ctx, userID)
+	if err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to list sessions")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	currentID := c.GetString("session_id")
+	result := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, gin.H{
+			"id":           session.ID,
+			"device":       session.Device,
+			"ip":           session.IP,
+			"user_agent":   session.UserAgent,
+			"created_at":   session.CreatedAt,
+			"last_seen_at": session.LastSeenAt,
+			"expires_at":   session.ExpiresAt,
+			"current":      session.ID == currentID,
+		})
+	}
+
+	c.JSON(200, gin.H{"sessions": result})
+}
+
+func (h *Handler) RevokeSession(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := c.GetString("user_id")
+	sessionID := c.Param("id")
+
+	if err := h.store.RevokeSession(ctx, userID, sessionID); err != nil {
+		if err == storages.ErrSessionNotFound {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Session not found")
+			return
+		}
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to revoke session")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	h.audit(c, AuditSessionRevoked, userID, map[string]interface{}{"session_id": sessionID})
+	h.logger.WithContext(ctx).WithField("user_id", userID).Info("session revoked")
+	c.JSON(200, gin.H{"message": "Session revoked"})
+}
+
+// RevokeOtherSessions завершает все сессии, кроме текущей.
+func (h *Handler) RevokeOtherSessions(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := c.GetString("user_id")
+
+	if err := h.store.RevokeOtherSessions(ctx, userID, c.GetString("session_id")); err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to revoke other sessions")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	h.audit(c, AuditOtherSessionsRevoked, userID, nil)
+	h.logger.WithContext(ctx).WithField("user_id", userID).Info("other sessions revoked")
+	c.JSON(200, gin.H{"message": "Other sessions revoked"})
+}
+
+// RefreshToken продлевает текущую сессию на sessionTTL и выдаёт новый JWT
+// для неё. Отозванную или истёкшую сессию продлить нельзя.
+func (h *Handler) RefreshToken(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := c.GetString("user_id")
+	userIDInt, err := strconv.Atoi(userID)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized")
+		return
+	}
+
+	tokenVersion, err := h.store.GetTokenVersion(ctx, userID)
+	if err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to get token version")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	session, err := h.store.RefreshSession(ctx, userID, c.GetString("session_id"), sessionTTL)
+	if err != nil {
+		if err == storages.ErrSessionInvalid {
+			apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Unauthorized")
+			return
+		}
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to refresh session")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	token, err := h.generateJWT(userIDInt, tokenVersion, session)
+	if err != nil {
+		h.logger.WithContext(ctx).WithError(err).Error("failed to generate JWT")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	h.audit(c, AuditTokenRefreshed, userID, map[string]interface{}{"session_id": session.ID})
+	h.logger.WithContext(ctx).WithField("user_id", userID).Info("token refreshed")
+	c.JSON(200, gin.H{"token": token})
+}
+
+// issueToken создаёт запись о сессии и подписывает привязанный к ней JWT.
+func (h *Handler) issueToken(c *gin.Context, userID, tokenVersion int) (string, error) {
+	ctx := c.Request.Context()
+
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	userAgent := c.Request.UserAgent()
+	session, err := h.store.CreateSession(ctx, storages.Session{
+		ID:        hex.EncodeToString(raw),
+		UserID:    fmt.Sprintf("%d", userID),
+		Device:    deviceFromUserAgent(userAgent),
+		IP:        c.ClientIP(),
+		UserAgent: userAgent,
+	}, sessionTTL)
+	if err != nil {
+		return "", err
+	}
+
+	return h.generateJWT(userID, tokenVersion, session)
+}
+
+// deviceFromUserAgent даёт короткое описание устройства для списка сессий.
+func deviceFromUserAgent(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	platform := "Unknown device"
+	switch {
+	case strings.Contains(ua, "iphone"):
+		platform = "iPhone"
+	case strings.Contains(ua, "ipad"):
+		platform = "iPad"
+	case strings.Contains(ua, "android"):
+		platform = "Android"
+	case strings.Contains(ua, "windows"):
+		platform = "Windows"
+	case strings.Contains(ua, "mac os"):
+		platform = "macOS"
+	case strings.Contains(ua, "linux"):
+		platform = "Linux"
+	}
+
+	browser := ""
+	switch {
+	case strings.Contains(ua, "edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "chrome/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "safari/"):
+		browser = "Safari"
+	case strings.Contains(ua, "curl/"):
+		browser = "curl"
+	}
+
+	if browser == "" {
+		return platform
+	}
+	return browser + " on " + platform
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/apierror"
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// streamHeartbeat — как часто писать в простаивающий поток комментарий,
+// чтобы прокси и балансировщики не закрывали соединение.
+const streamHeartbeat = 25 * time.Second
+
+// События потока /wallet/stream
+const (
+	StreamEventBalance     = "balance"
+	StreamEventTransaction = "transaction"
+)
+
+// WalletStream отправляет клиенту события кошелька по SSE: balance —
+// баланс сразу после подключения и после каждой операции, transaction —
+// операция в том же виде, что и тело вебхука. Операции, сделанные через
+// другие экземпляры сервиса, приходят через LISTEN/NOTIFY.
+func (h *Handler) WalletStream(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := c.GetString("user_id")
+	if !h.runtime().features.WalletStream {
+		respondFeatureDisabled(c)
+		return
+	}
+
+	// Подписка раньше чтения баланса, чтобы не пропустить операцию между ними.
+	sub := h.stream.Subscribe(userID)
+	defer sub.Close()
+
+	balance, err := h.Balance(ctx, userID)
+	if err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to get balance")
+		apierror.Abort(c, apierror.New(http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve balance").WithCause(err))
+		return
+	}
+
+	// Поток живёт дольше WriteTimeout сервера.
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		h.logger.WithContext(ctx).WithError(err).Warn("failed to clear write deadline for stream")
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Render(http.StatusOK, sse.Event{Event: StreamEventBalance, Data: gin.H{"balance": balance}})
+	c.Writer.Flush()
+
+	h.logger.WithContext(ctx).WithField("user_id", userID).Info("wallet stream opened")
+	defer h.logger.WithContext(ctx).WithField("user_id", userID).Info("wallet stream closed")
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if _, err := c.Writer.WriteString(": ping\n\n"); err != nil {
+				return
+			}
+		case m, ok := <-sub.C:
+			if !ok {
+				// Сервис останавливается или клиент не успевал читать.
+				return
+			}
+			if !m.Resync {
+				c.Render(-1, sse.Event{Event: StreamEventTransaction, Id: m.ID, Data: m.Event})
+			}
+			balance, err := h.Balance(ctx, userID)
+			if err != nil {
+				if ctx.Err() == nil {
+					h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to get balance for stream")
+				}
+				return
+			}
+			c.Render(-1, sse.Event{Event: StreamEventBalance, Data: gin.H{"balance": balance}})
+		}
+		c.Writer.Flush()
+	}
+}
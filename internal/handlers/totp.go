@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/apierror"
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+	"github.com/Krchnk/gw-currency-wallet/internal/totp"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	mfaTokenTTL = 5 * time.Minute
+	// mfaMaxAttempts — сколько кодов можно проверить по одному mfa_token
+	mfaMaxAttempts = 5
+)
+
+// Ошибки подтверждения вывода вторым фактором
+var (
+	ErrStepUpRequired  = errors.New("totp code required for this withdrawal")
+	ErrInvalidTOTPCode = errors.New("invalid totp code")
+)
+
+// EnrollTOTP создаёт новый секрет и возвращает его вместе с otpauth:// URI.
+// 2FA начинает действовать только после ConfirmTOTP.
+func (h *Handler) EnrollTOTP(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := c.GetString("user_id")
+	h.logger.WithContext(ctx).WithField("user_id", userID).Info("totp enrollment attempt")
+
+	user, err := h.store.GetUserByID(ctx, userID)
+	if err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to get user for totp enrollment")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		h.logger.WithContext(ctx).WithError(err).Error("failed to generate totp secret")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	encrypted, err := h.cipher.Encrypt(secret)
+	if err != nil {
+		h.logger.WithContext(ctx).WithError(err).Error("failed to encrypt totp secret")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	if err := h.store.SaveTOTPSecret(ctx, userID, encrypted); err != nil {
+		if err == storages.ErrTOTPAlreadyEnabled {
+			apierror.Respond(c, http.StatusConflict, apierror.CodeTOTPAlreadyEnabled, "Two-factor authentication already enabled")
+			return
+		}
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to save totp secret")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	h.logger.WithContext(ctx).WithField("user_id", userID).Info("totp enrollment started")
+	c.JSON(200, gin.H{
+		"secret":           secret,
+		"provisioning_uri": totp.ProvisioningURI(h.cfg.TOTP.Issuer, user.Username, secret),
+	})
+}
+
+// ConfirmTOTP включает 2FA после проверки первого кода и выдаёт коды
+// восстановления. Коды показываются только в этом ответе.
+func (h *Handler) ConfirmTOTP(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req TOTPCodeRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	userID := c.GetString("user_id")
+	record, err := h.store.GetTOTP(ctx, userID)
+	if err != nil {
+		if err == storages.ErrTOTPNotEnrolled {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeTOTPNotEnrolled, "Two-factor enrollment not started")
+			return
+		}
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to get totp")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+	if record.Confirmed {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeTOTPAlreadyEnabled, "Two-factor authentication already enabled")
+		return
+	}
+
+	secret, err := h.cipher.Decrypt(record.EncryptedSecret)
+	if err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to decrypt totp secret")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	step, ok := totp.Validate(secret, req.Code, time.Now())
+	if !ok {
+		h.logger.WithContext(ctx).WithField("user_id", userID).Error("invalid totp code on confirmation")
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidTOTPCode, "Invalid TOTP code")
+		return
+	}
+
+	codes, err := totp.GenerateRecoveryCodes()
+	if err != nil {
+		h.logger.WithContext(ctx).WithError(err).Error("failed to generate recovery codes")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = totp.HashRecoveryCode(code)
+	}
+
+	if err := h.store.ConfirmTOTP(ctx, userID, step, hashes); err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to confirm totp")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	h.audit(c, AuditTOTPEnabled, userID, nil)
+	h.logger.WithContext(ctx).WithField("user_id", userID).Info("totp enabled")
+	c.JSON(200, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTOTP отключает 2FA. Требует действующий код или код восстановления.
+func (h *Handler) DisableTOTP(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req SecondFactorRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	userID := c.GetString("user_id")
+	if err := h.verifySecondFactor(ctx, userID, req.Code, req.RecoveryCode); err != nil {
+		h.audit(c, AuditSecondFactorFailed, userID, map[string]interface{}{"action": "disable_2fa"})
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("second factor verification failed")
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeSecondFactorFailed, "Invalid TOTP or recovery code")
+		return
+	}
+
+	if err := h.store.DeleteTOTP(ctx, userID); err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to disable totp")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	h.audit(c, AuditTOTPDisabled, userID, map[string]interface{}{"recovery_code_used": req.RecoveryCode != ""})
+	h.logger.WithContext(ctx).WithField("user_id", userID).Info("totp disabled")
+	c.JSON(200, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// LoginTOTP — второй шаг входа: обменивает mfa_token из Login и TOTP-код
+// (или код восстановления) на обычный JWT.
+func (h *Handler) LoginTOTP(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req LoginTOTPRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	claims, err := h.parseToken(req.MFAToken)
+	if err != nil || claims["purpose"] != "mfa" {
+		h.logger.WithContext(ctx).WithError(err).Error("invalid MFA token")
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeMFATokenInvalid, "Invalid or expired MFA token")
+		return
+	}
+
+	userIDStr, _ := claims["user_id"].(string)
+	challengeID, _ := claims["jti"].(string)
+	if err := h.store.TakeMFAAttempt(ctx, challengeID, userIDStr, mfaMaxAttempts); err != nil {
+		if err == storages.ErrMFAChallengeInvalid {
+			h.logger.WithContext(ctx).WithField("user_id", userIDStr).Error("MFA token used, expired or out of attempts")
+			apierror.Respond(c, http.StatusUnauthorized, apierror.CodeMFATokenInvalid, "Invalid or expired MFA token")
+			return
+		}
+		h.logger.WithContext(ctx).WithError(err).Error("failed to take MFA attempt")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	user, err := h.store.GetUserByID(ctx, userIDStr)
+	if err != nil {
+		h.logger.WithContext(ctx).WithError(err).Error("failed to get user from MFA token")
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeMFATokenInvalid, "Invalid or expired MFA token")
+		return
+	}
+
+	if err := h.verifySecondFactor(ctx, userIDStr, req.Code, req.RecoveryCode); err != nil {
+		h.audit(c, AuditSecondFactorFailed, userIDStr, map[string]interface{}{"action": "login"})
+		h.logger.WithContext(ctx).WithField("user_id", userIDStr).WithError(err).Error("second factor verification failed")
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeSecondFactorFailed, "Invalid TOTP or recovery code")
+		return
+	}
+
+	// Один mfa_token — один вход, даже если код ещё не сменился.
+	if err := h.store.CompleteMFAChallenge(ctx, challengeID); err != nil {
+		if err == storages.ErrMFAChallengeInvalid {
+			h.logger.WithContext(ctx).WithField("user_id", userIDStr).Error("MFA token already used")
+			apierror.Respond(c, http.StatusUnauthorized, apierror.CodeMFATokenInvalid, "Invalid or expired MFA token")
+			return
+		}
+		h.logger.WithContext(ctx).WithError(err).Error("failed to complete MFA challenge")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	token, err := h.issueToken(c, user.ID, user.TokenVersion)
+	if err != nil {
+		h.logger.WithContext(ctx).WithError(err).Error("failed to generate JWT")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	h.audit(c, AuditLoginSucceeded, userIDStr, map[string]interface{}{
+		"second_factor":      true,
+		"recovery_code_used": req.RecoveryCode != "",
+	})
+	h.logger.WithContext(ctx).WithField("user_id", userIDStr).Info("login successful")
+	c.JSON(200, gin.H{"token": token})
+}
+
+func (h *Handler) totpEnabled(ctx context.Context, userID string) (bool, error) {
+	record, err := h.store.GetTOTP(ctx, userID)
+	if err == storages.ErrTOTPNotEnrolled {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return record.Confirmed, nil
+}
+
+// verifySecondFactor принимает либо TOTP-код, либо код восстановления.
+// Принятый TOTP-код помечается использованным и повторно не сработает.
+func (h *Handler) verifySecondFactor(ctx context.Context, userID, code, recoveryCode string) error {
+	if recoveryCode != "" {
+		return h.store.UseRecoveryCode(ctx, userID, totp.HashRecoveryCode(recoveryCode))
+	}
+
+	record, err := h.store.GetTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !record.Confirmed {
+		return storages.ErrTOTPNotEnrolled
+	}
+
+	secret, err := h.cipher.Decrypt(record.EncryptedSecret)
+	if err != nil {
+		return err
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidTOTPCode
+	}
+	return h.store.UseTOTPStep(ctx, userID, step)
+}
+
+// requireStepUp проверяет TOTP-код для вывода больше порога. Пользователи
+// без 2FA проверку проходят: подтвердить операцию им нечем.
+func (h *Handler) requireStepUp(ctx context.Context, userID, currency string, amount float64, code string) error {
+	threshold := h.runtime().stepUpThreshold
+	if threshold <= 0 {
+		return nil
+	}
+
+	fields := logrus.Fields{"user_id": userID, "threshold": threshold}
+	usdAmount, converted := amount, true
+	if currency != "USD" {
+		// Без курса сумму в USD не узнать: считаем, что порог превышен,
+		// а не отказываем в выводе из-за сбоя сервиса курсов.
+		rate, err := h.getExchangeRate(ctx, currency, "USD")
+		if err != nil {
+			h.logger.WithContext(ctx).WithField("currency", currency).WithError(err).
+				Warn("failed to convert withdraw amount to USD, requiring step-up")
+			converted = false
+		} else {
+			usdAmount = amount * rate
+		}
+	}
+	if converted {
+		if usdAmount <= threshold {
+			return nil
+		}
+		fields["usd_amount"] = usdAmount
+	}
+
+	enrolled, err := h.totpEnabled(ctx, userID)
+	if err != nil || !enrolled {
+		return err
+	}
+
+	h.logger.WithContext(ctx).WithFields(fields).Info("withdraw requires step-up verification")
+
+	if code == "" {
+		return ErrStepUpRequired
+	}
+	if err := h.verifySecondFactor(ctx, userID, code, ""); err != nil {
+		if err == storages.ErrTOTPCodeUsed {
+			return ErrInvalidTOTPCode
+		}
+		return err
+	}
+	return nil
+}
+
+// generateMFAToken выдаёт короткоживущий токен между первым и вторым
+// шагом входа. AuthMiddleware такие токены не принимает. Попытки ввода
+// кода считаются по jti, см. mfaMaxAttempts.
+func (h *Handler) generateMFAToken(ctx context.Context, userID int) (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	challengeID := hex.EncodeToString(raw)
+	if err := h.store.CreateMFAChallenge(ctx, challengeID, fmt.Sprintf("%d", userID), mfaTokenTTL); err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": fmt.Sprintf("%d", userID),
+		"purpose": "mfa",
+		"jti":     challengeID,
+		"exp":     time.Now().Add(mfaTokenTTL).Unix(),
+	})
+	return token.SignedString([]byte(h.cfg.JWTSecret))
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/metrics"
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+	"github.com/Krchnk/gw-currency-wallet/internal/validation"
+)
+
+// Операции с кошельком, общие для REST и gRPC API. Транспорт отвечает только
+// за разбор запроса и перевод ошибок в свои коды ответа.
+
+var (
+	ErrInvalidAmount   = errors.New("invalid amount or currency")
+	ErrFeatureDisabled = errors.New("operation is disabled")
+)
+
+// Размер страницы истории операций
+const (
+	DefaultTransactionsLimit = 50
+	MaxTransactionsLimit     = 200
+)
+
+func (h *Handler) Balance(ctx context.Context, userID string) (map[string]float64, error) {
+	return h.store.GetBalance(ctx, userID)
+}
+
+// DepositFunds зачисляет сумму за вычетом комиссии и возвращает новый баланс.
+func (h *Handler) DepositFunds(ctx context.Context, userID, currency string, amount float64) (map[string]float64, error) {
+	settings := h.runtime()
+	if !settings.features.Deposit {
+		return nil, ErrFeatureDisabled
+	}
+	if !validation.IsMoney(amount) || !isValidCurrency(currency) {
+		return nil, ErrInvalidAmount
+	}
+	fee := feeFor(amount, settings.fees.DepositPercent)
+	if fee >= amount {
+		return nil, ErrInvalidAmount
+	}
+	if err := h.store.Deposit(ctx, userID, currency, amount, fee); err != nil {
+		return nil, err
+	}
+	metrics.ObserveOperation(metrics.OperationDeposit, currency, amount)
+	return h.balanceAfter(ctx, userID), nil
+}
+
+// WithdrawFunds списывает сумму и комиссию сверх неё. Вывод больше порога у
+// пользователей с 2FA требует TOTP-кода: без него возвращается
+// ErrStepUpRequired, с неверным кодом — ErrInvalidTOTPCode.
+func (h *Handler) WithdrawFunds(ctx context.Context, userID, currency string, amount float64, totpCode string) (map[string]float64, error) {
+	settings := h.runtime()
+	if !settings.features.Withdraw {
+		return nil, ErrFeatureDisabled
+	}
+	if !validation.IsMoney(amount) || !isValidCurrency(currency) {
+		return nil, ErrInvalidAmount
+	}
+	if err := h.requireStepUp(ctx, userID, currency, amount, totpCode); err != nil {
+		return nil, err
+	}
+	fee := feeFor(amount, settings.fees.WithdrawPercent)
+	if err := h.store.Withdraw(ctx, userID, currency, amount, fee); err != nil {
+		return nil, err
+	}
+	metrics.ObserveOperation(metrics.OperationWithdraw, currency, amount)
+	return h.balanceAfter(ctx, userID), nil
+}
+
+// ExchangeFunds меняет валюту по курсу из кэша или базы и возвращает
+// зачисленную сумму и новый баланс. Комиссия удерживается из обмениваемой
+// суммы.
+func (h *Handler) ExchangeFunds(ctx context.Context, userID, from, to string, amount float64) (float64, map[string]float64, error) {
+	settings := h.runtime()
+	if !settings.features.Exchange {
+		return 0, nil, ErrFeatureDisabled
+	}
+	if !isValidCurrency(from) || !isValidCurrency(to) || !validation.IsMoney(amount) {
+		return 0, nil, ErrInvalidAmount
+	}
+	fee := feeFor(amount, settings.fees.ExchangePercent)
+	if fee >= amount {
+		return 0, nil, ErrInvalidAmount
+	}
+
+	rate, err := h.getExchangeRate(ctx, from, to)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := h.store.Exchange(ctx, userID, from, to, amount, fee, rate); err != nil {
+		return 0, nil, err
+	}
+	exchanged := (amount - fee) * rate
+	metrics.ObserveOperation(metrics.OperationExchangeSold, from, amount)
+	metrics.ObserveOperation(metrics.OperationExchangeBought, to, exchanged)
+	return exchanged, h.balanceAfter(ctx, userID), nil
+}
+
+// feeFor — комиссия percent процентов от amount, округлённая до цента.
+func feeFor(amount, percent float64) float64 {
+	return math.Round(amount*percent) / 100
+}
+
+// balanceAfter читает баланс после проведённой операции. Ошибка чтения не
+// превращает успешную операцию в неуспешную, иначе клиент может её повторить.
+func (h *Handler) balanceAfter(ctx context.Context, userID string) map[string]float64 {
+	balance, err := h.store.GetBalance(ctx, userID)
+	if err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to read balance after operation")
+	}
+	return balance
+}
+
+// Transactions возвращает операции пользователя от новых к старым. Лимит
+// вне допустимого диапазона заменяется значением по умолчанию.
+func (h *Handler) Transactions(ctx context.Context, userID string, beforeID int64, limit int) ([]storages.Transaction, error) {
+	if limit <= 0 || limit > MaxTransactionsLimit {
+		limit = DefaultTransactionsLimit
+	}
+	return h.store.ListTransactions(ctx, storages.TransactionFilter{
+		UserID:   userID,
+		BeforeID: beforeID,
+		Limit:    limit,
+	})
+}
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/apierror"
+	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+	"github.com/Krchnk/gw-currency-wallet/internal/validation"
+	"github.com/Krchnk/gw-currency-wallet/internal/webhooks"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// maxWebhooks ограничивает число вебхуков у одного пользователя.
+const maxWebhooks = 10
+
+const (
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 200
+)
+
+// CreateWebhook регистрирует адрес для событий кошелька. Секрет для
+// проверки подписи возвращается только в этом ответе.
+func (h *Handler) CreateWebhook(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req CreateWebhookRequest
+	if !h.bindJSON(c, &req) {
+		return
+	}
+
+	var errs []validation.FieldError
+	if err := webhooks.ValidateURL(req.URL, h.cfg.Env == config.EnvProduction); err != nil {
+		errs = append(errs, validation.FieldError{Field: "url", Message: err.Error()})
+	}
+	seen := make(map[string]bool)
+	var events []string
+	for i, event := range req.Events {
+		if !webhooks.KnownEvent(event) {
+			errs = append(errs, validation.FieldError{Field: fmt.Sprintf("events[%d]", i), Message: "is not a known event"})
+			continue
+		}
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+	if len(errs) > 0 {
+		apierror.Abort(c, apierror.Validation(errs))
+		return
+	}
+
+	userID := c.GetString("user_id")
+
+	existing, err := h.store.ListWebhooks(ctx, userID)
+	if err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to list webhooks")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+	if len(existing) >= maxWebhooks {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeWebhookLimitReached, fmt.Sprintf("At most %d webhooks are allowed", maxWebhooks))
+		return
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		h.logger.WithContext(ctx).WithError(err).Error("failed to generate webhook secret")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+	encrypted, err := h.cipher.Encrypt(secret)
+	if err != nil {
+		h.logger.WithContext(ctx).WithError(err).Error("failed to encrypt webhook secret")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	endpoint, err := h.store.CreateWebhook(ctx, storages.WebhookEndpoint{
+		UserID: userID,
+		URL:    req.URL,
+		Events: events,
+	}, encrypted)
+	if err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to create webhook")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	h.audit(c, AuditWebhookCreated, userID, map[string]interface{}{
+		"webhook_id": endpoint.ID,
+		"url":        endpoint.URL,
+		"events":     endpoint.Events,
+	})
+	h.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"webhook_id": endpoint.ID,
+		"events":     endpoint.Events,
+	}).Info("webhook created")
+	c.JSON(201, gin.H{"webhook": endpoint, "secret": secret})
+}
+
+func (h *Handler) ListWebhooks(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := c.GetString("user_id")
+
+	endpoints, err := h.store.ListWebhooks(ctx, userID)
+	if err != nil {
+		h.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to list webhooks")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	c.JSON(200, gin.H{"webhooks": endpoints})
+}
+
+// DeleteWebhook удаляет вебхук; недоставленные события для него отменяются.
+func (h *Handler) DeleteWebhook(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := c.GetString("user_id")
+	endpointID, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.store.DeleteWebhook(ctx, userID, endpointID); err != nil {
+		if err == storages.ErrWebhookNotFound {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Webhook not found")
+			return
+		}
+		h.logger.WithContext(ctx).WithField("webhook_id", endpointID).WithError(err).Error("failed to delete webhook")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	h.audit(c, AuditWebhookDeleted, userID, map[string]interface{}{"webhook_id": endpointID})
+	h.logger.WithContext(ctx).WithField("webhook_id", endpointID).Info("webhook deleted")
+	c.JSON(200, gin.H{"message": "Webhook deleted"})
+}
+
+// ListWebhookDeliveries возвращает доставки вебхука с фильтром status и
+// курсором before_id. status=dead — доставки, исчерпавшие попытки.
+func (h *Handler) ListWebhookDeliveries(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	endpointID, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	filter := storages.DeliveryFilter{
+		UserID:     c.GetString("user_id"),
+		EndpointID: endpointID,
+		Status:     c.Query("status"),
+		Limit:      defaultDeliveriesLimit,
+	}
+
+	switch filter.Status {
+	case "", storages.DeliveryPending, storages.DeliveryDelivered, storages.DeliveryDead:
+	default:
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid status")
+		return
+	}
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 || parsed > maxDeliveriesLimit {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid limit")
+			return
+		}
+		filter.Limit = parsed
+	}
+	if raw := c.Query("before_id"); raw != "" {
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || parsed <= 0 {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid before_id")
+			return
+		}
+		filter.BeforeID = parsed
+	}
+
+	deliveries, err := h.store.ListWebhookDeliveries(ctx, filter)
+	if err != nil {
+		if err == storages.ErrWebhookNotFound {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Webhook not found")
+			return
+		}
+		h.logger.WithContext(ctx).WithField("webhook_id", endpointID).WithError(err).Error("failed to list webhook deliveries")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	c.JSON(200, gin.H{"deliveries": deliveries})
+}
+
+// ReplayWebhookDelivery отправляет доставку заново, в том числе уже
+// доставленную или ушедшую в dead letter.
+func (h *Handler) ReplayWebhookDelivery(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := c.GetString("user_id")
+	endpointID, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	deliveryID, err := strconv.ParseInt(c.Param("delivery_id"), 10, 64)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid delivery id")
+		return
+	}
+
+	if err := h.store.ReplayWebhookDelivery(ctx, userID, endpointID, deliveryID); err != nil {
+		if err == storages.ErrDeliveryNotFound {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Delivery not found")
+			return
+		}
+		h.logger.WithContext(ctx).WithField("delivery_id", deliveryID).WithError(err).Error("failed to replay webhook delivery")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	h.audit(c, AuditWebhookReplayed, userID, map[string]interface{}{
+		"webhook_id":  endpointID,
+		"delivery_id": deliveryID,
+	})
+	c.JSON(202, gin.H{"replayed": 1})
+}
+
+// ReplayDeadWebhookDeliveries возвращает в очередь все доставки вебхука,
+// исчерпавшие попытки.
+func (h *Handler) ReplayDeadWebhookDeliveries(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := c.GetString("user_id")
+	endpointID, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	replayed, err := h.store.ReplayDeadWebhookDeliveries(ctx, userID, endpointID)
+	if err != nil {
+		if err == storages.ErrWebhookNotFound {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Webhook not found")
+			return
+		}
+		h.logger.WithContext(ctx).WithField("webhook_id", endpointID).WithError(err).Error("failed to replay dead webhook deliveries")
+		apierror.Abort(c, apierror.Internal(err))
+		return
+	}
+
+	h.audit(c, AuditWebhookReplayed, userID, map[string]interface{}{
+		"webhook_id": endpointID,
+		"replayed":   replayed,
+	})
+	c.JSON(202, gin.H{"replayed": replayed})
+}
+
+func webhookID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "Invalid webhook id")
+		return 0, false
+	}
+	return id, true
+}
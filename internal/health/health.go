@@ -0,0 +1,192 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Database — то, что нужно проверкам от хранилища.
+type Database interface {
+	Ping(ctx context.Context) error
+	// SchemaVersion возвращает версию последней применённой миграции и
+	// признак dirty, если миграция упала на середине.
+	SchemaVersion(ctx context.Context) (int64, bool, error)
+	ServerVersion(ctx context.Context) (string, error)
+}
+
+var migrationFile = regexp.MustCompile(`^(\d+)_.+\.up\.sql$`)
+
+// Checker отвечает на /healthz и /readyz и собирает страницу статуса.
+type Checker struct {
+	db              Database
+	rates           healthpb.HealthClient
+	latestMigration int64
+	version         string
+	timeout         time.Duration
+	started         time.Time
+	logger          *logrus.Logger
+}
+
+// New читает каталог миграций, чтобы знать последнюю версию схемы. Пустой
+// migrationsDir отключает проверку миграций.
+func New(db Database, ratesConn grpc.ClientConnInterface, migrationsDir, version string, timeout time.Duration, logger *logrus.Logger) (*Checker, error) {
+	var latest int64
+	if migrationsDir != "" {
+		entries, err := os.ReadDir(migrationsDir)
+		if err != nil {
+			return nil, fmt.Errorf("read migrations dir: %w", err)
+		}
+		for _, entry := range entries {
+			m := migrationFile.FindStringSubmatch(entry.Name())
+			if m == nil {
+				continue
+			}
+			v, err := strconv.ParseInt(m[1], 10, 64)
+			if err == nil && v > latest {
+				latest = v
+			}
+		}
+	}
+
+	return &Checker{
+		db:              db,
+		rates:           healthpb.NewHealthClient(ratesConn),
+		latestMigration: latest,
+		version:         version,
+		timeout:         timeout,
+		started:         time.Now(),
+		logger:          logger,
+	}, nil
+}
+
+type checkResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Healthz — проверка живости: процесс отвечает, зависимости не проверяются.
+func (h *Checker) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz — проверка готовности принимать трафик: доступны Postgres и
+// сервис курсов, все миграции применены.
+func (h *Checker) Readyz(c *gin.Context) {
+	results := h.runChecks(c.Request.Context())
+
+	status := http.StatusOK
+	overall := "ok"
+	for name, res := range results {
+		if res.Status != "ok" {
+			status = http.StatusServiceUnavailable
+			overall = "unavailable"
+			h.logger.WithContext(c.Request.Context()).WithFields(logrus.Fields{
+				"check": name,
+				"error": res.Error,
+			}).Warn("readiness check failed")
+		}
+	}
+
+	c.JSON(status, gin.H{"status": overall, "checks": results})
+}
+
+// Status возвращает версии, время работы и задержку до зависимостей.
+func (h *Checker) Status(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeout)
+	defer cancel()
+
+	response := gin.H{
+		"version":    h.version,
+		"go_version": runtime.Version(),
+		"started_at": h.started.UTC(),
+		"uptime":     time.Since(h.started).Round(time.Second).String(),
+		"checks":     h.runChecks(c.Request.Context()),
+	}
+
+	if v, err := h.db.ServerVersion(ctx); err == nil {
+		response["postgres_version"] = v
+	}
+	if current, dirty, err := h.db.SchemaVersion(ctx); err == nil {
+		response["migrations"] = gin.H{
+			"current": current,
+			"latest":  h.latestMigration,
+			"dirty":   dirty,
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *Checker) runChecks(ctx context.Context) map[string]checkResult {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	checks := map[string]func(context.Context) error{
+		"postgres":       h.db.Ping,
+		"exchange_rates": h.checkRates,
+		"migrations":     h.checkMigrations,
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]checkResult, len(checks))
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := check(ctx)
+			res := checkResult{
+				Status:    "ok",
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				res.Status = "fail"
+				res.Error = err.Error()
+			}
+			mu.Lock()
+			results[name] = res
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (h *Checker) checkRates(ctx context.Context) error {
+	resp, err := h.rates.Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		return err
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("exchange rates service is %s", resp.GetStatus())
+	}
+	return nil
+}
+
+func (h *Checker) checkMigrations(ctx context.Context) error {
+	current, dirty, err := h.db.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("migration %d is dirty", current)
+	}
+	if current < h.latestMigration {
+		return fmt.Errorf("pending migrations: schema at %d, latest is %d", current, h.latestMigration)
+	}
+	return nil
+}
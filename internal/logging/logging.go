@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"github.com/Krchnk/gw-currency-wallet/internal/requestid"
+	"github.com/Krchnk/gw-currency-wallet/internal/tracing"
+	"github.com/sirupsen/logrus"
+)
+
+// Форматы вывода журнала
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Configure настраивает логгер сервиса: уровень, формат, маскирование и
+// хуки, добавляющие trace_id, request_id и поля из WithFields. Вызывается при
+// запуске и при перечитывании конфигурации.
+func Configure(logger *logrus.Logger, cfg config.LoggingConfig) error {
+	level, err := logrus.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return err
+	}
+	policy, err := NewPolicy(cfg.LogRedact)
+	if err != nil {
+		return err
+	}
+
+	var formatter logrus.Formatter
+	switch cfg.LogFormat {
+	case FormatJSON, "":
+		formatter = &logrus.JSONFormatter{}
+	case FormatText:
+		formatter = &logrus.TextFormatter{FullTimestamp: true}
+	default:
+		return fmt.Errorf("unknown log format %q", cfg.LogFormat)
+	}
+
+	hooks := make(logrus.LevelHooks)
+	hooks.Add(tracing.LogrusHook{})
+	hooks.Add(requestid.LogrusHook{})
+	hooks.Add(contextHook{})
+
+	logger.SetLevel(level)
+	logger.SetFormatter(&redactingFormatter{next: formatter, policy: policy})
+	logger.ReplaceHooks(hooks)
+	return nil
+}
+
+type fieldsKey struct{}
+
+// WithFields добавляет поля ко всем записям, сделанным через
+// logger.WithContext(ctx) с возвращённым контекстом. Так user_id, найденный
+// при аутентификации, попадает и в журнал запросов, и в журнал хранилища.
+func WithFields(ctx context.Context, fields logrus.Fields) context.Context {
+	merged := make(logrus.Fields)
+	for k, v := range fieldsFrom(ctx) {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+func fieldsFrom(ctx context.Context) logrus.Fields {
+	fields, _ := ctx.Value(fieldsKey{}).(logrus.Fields)
+	return fields
+}
+
+// contextHook дописывает поля из WithFields, не перекрывая заданные явно.
+type contextHook struct{}
+
+func (contextHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (contextHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	for k, v := range fieldsFrom(entry.Context) {
+		if _, ok := entry.Data[k]; !ok {
+			entry.Data[k] = v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package logging
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Категории данных, которые маскируются в журнале
+const (
+	RedactEmail    = "email"
+	RedactAmount   = "amount"
+	RedactToken    = "token"
+	RedactUsername = "username"
+)
+
+const redacted = "[REDACTED]"
+
+// Поля, значения которых маскируются целиком или частично
+var (
+	amountFields = map[string]bool{
+		"amount":           true,
+		"to_amount":        true,
+		"balance":          true,
+		"new_balance":      true,
+		"exchanged_amount": true,
+	}
+	tokenFields = map[string]bool{
+		"token":         true,
+		"mfa_token":     true,
+		"password":      true,
+		"secret":        true,
+		"authorization": true,
+		"api_key":       true,
+		"totp_code":     true,
+		"recovery_code": true,
+	}
+	usernameFields = map[string]bool{
+		"username": true,
+	}
+
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// Токены в ссылках из писем и в заголовке Authorization
+	tokenPattern = regexp.MustCompile(`(?i)(token=|bearer\s+)[^&\s"]+`)
+)
+
+// Policy определяет, какие данные маскируются.
+type Policy struct {
+	Emails    bool
+	Amounts   bool
+	Tokens    bool
+	Usernames bool
+}
+
+// NewPolicy собирает политику из списка категорий.
+func NewPolicy(categories []string) (Policy, error) {
+	var p Policy
+	for _, c := range categories {
+		switch strings.TrimSpace(c) {
+		case RedactEmail:
+			p.Emails = true
+		case RedactAmount:
+			p.Amounts = true
+		case RedactToken:
+			p.Tokens = true
+		case RedactUsername:
+			p.Usernames = true
+		default:
+			return Policy{}, fmt.Errorf("unknown redaction category %q", c)
+		}
+	}
+	return p, nil
+}
+
+// redactingFormatter маскирует данные перед форматированием, то есть после
+// всех хуков, которые могли добавить поля.
+type redactingFormatter struct {
+	next   logrus.Formatter
+	policy Policy
+}
+
+func (f *redactingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	clone := *entry
+	clone.Message = f.policy.redactString(entry.Message)
+	clone.Data = make(logrus.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		clone.Data[k] = f.policy.redactField(k, v)
+	}
+	return f.next.Format(&clone)
+}
+
+func (p Policy) redactField(key string, value interface{}) interface{} {
+	switch {
+	case p.Amounts && amountFields[key], p.Tokens && tokenFields[key]:
+		return redacted
+	case p.Usernames && usernameFields[key]:
+		return maskString(fmt.Sprint(value))
+	}
+
+	switch v := value.(type) {
+	case string:
+		return p.redactString(v)
+	case logrus.Fields:
+		return logrus.Fields(p.redactMap(v))
+	case map[string]interface{}:
+		return p.redactMap(v)
+	case map[string]string:
+		out := make(map[string]string, len(v))
+		for k, s := range v {
+			out[k] = fmt.Sprint(p.redactField(k, s))
+		}
+		return out
+	case error:
+		if s := v.Error(); p.redactString(s) != s {
+			return p.redactString(s)
+		}
+	}
+	return value
+}
+
+// redactMap маскирует вложенные поля, например метаданные аудита, не
+// изменяя исходную карту.
+func (p Policy) redactMap(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = p.redactField(k, v)
+	}
+	return out
+}
+
+func (p Policy) redactString(s string) string {
+	if p.Emails {
+		s = emailPattern.ReplaceAllStringFunc(s, maskEmail)
+	}
+	if p.Tokens {
+		s = tokenPattern.ReplaceAllString(s, "${1}"+redacted)
+	}
+	return s
+}
+
+// maskEmail оставляет первый символ и домен: j***@example.com.
+func maskEmail(email string) string {
+	local, domain, _ := strings.Cut(email, "@")
+	return maskString(local) + "@" + domain
+}
+
+func maskString(s string) string {
+	if s == "" {
+		return s
+	}
+	_, size := utf8.DecodeRuneInString(s)
+	return s[:size] + "***"
+}
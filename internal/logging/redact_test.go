@@ -0,0 +1,146 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+var allCategories = []string{RedactEmail, RedactAmount, RedactToken, RedactUsername}
+
+func mustPolicy(t *testing.T, categories []string) Policy {
+	t.Helper()
+	p, err := NewPolicy(categories)
+	if err != nil {
+		t.Fatalf("NewPolicy(%v): %v", categories, err)
+	}
+	return p
+}
+
+func TestNewPolicyUnknownCategory(t *testing.T) {
+	if _, err := NewPolicy([]string{"email", "phone"}); err == nil {
+		t.Error("NewPolicy accepted an unknown category")
+	}
+}
+
+func TestRedactField(t *testing.T) {
+	tests := []struct {
+		category string
+		key      string
+		value    interface{}
+		want     interface{}
+	}{
+		{RedactEmail, "email", "john.doe@example.com", "j***@example.com"},
+		{RedactEmail, "message", "sent to a@b.io and c@d.org", "sent to a***@b.io and c***@d.org"},
+		{RedactAmount, "amount", 150.25, redacted},
+		{RedactAmount, "balance", map[string]float64{"USD": 10}, redacted},
+		{RedactAmount, "exchanged_amount", 9.5, redacted},
+		{RedactToken, "token", "eyJhbGciOi", redacted},
+		{RedactToken, "mfa_token", "eyJhbGciOi", redacted},
+		{RedactToken, "totp_code", "123456", redacted},
+		{RedactToken, "url", "https://app/verify?token=abc123&lang=ru", "https://app/verify?token=" + redacted + "&lang=ru"},
+		{RedactToken, "header", "Bearer abc.def.ghi", "Bearer " + redacted},
+		{RedactUsername, "username", "alice", "a***"},
+		{RedactUsername, "username", "", ""},
+	}
+	for _, tt := range tests {
+		on := mustPolicy(t, []string{tt.category})
+		if got := on.redactField(tt.key, tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: redactField(%q, %v) = %v, want %v", tt.category, tt.key, tt.value, got, tt.want)
+		}
+
+		// Без категории в политике значение остаётся как есть.
+		var off Policy
+		if got := off.redactField(tt.key, tt.value); !reflect.DeepEqual(got, tt.value) {
+			t.Errorf("%s disabled: redactField(%q, %v) = %v, want unchanged", tt.category, tt.key, tt.value, got)
+		}
+	}
+}
+
+func TestRedactFieldError(t *testing.T) {
+	p := mustPolicy(t, allCategories)
+
+	err := errors.New(`pq: duplicate key value for email "bob@example.com"`)
+	got, ok := p.redactField("error", err).(string)
+	if !ok || strings.Contains(got, "bob@example.com") {
+		t.Errorf("redactField(error) = %v, want email masked", got)
+	}
+
+	plain := errors.New("connection refused")
+	if got := p.redactField("error", plain); got != plain {
+		t.Errorf("redactField(error) = %v, want the original error", got)
+	}
+}
+
+func TestRedactNestedFields(t *testing.T) {
+	p := mustPolicy(t, allCategories)
+
+	metadata := map[string]interface{}{
+		"amount":   100.0,
+		"currency": "USD",
+		"user": logrus.Fields{
+			"username": "alice",
+			"email":    "alice@example.com",
+		},
+		"headers": map[string]string{
+			"authorization": "Bearer abc",
+			"user-agent":    "curl",
+		},
+	}
+	want := map[string]interface{}{
+		"amount":   redacted,
+		"currency": "USD",
+		"user": logrus.Fields{
+			"username": "a***",
+			"email":    "a***@example.com",
+		},
+		"headers": map[string]string{
+			"authorization": redacted,
+			"user-agent":    "curl",
+		},
+	}
+
+	if got := p.redactField("metadata", metadata); !reflect.DeepEqual(got, want) {
+		t.Errorf("redactField(metadata) = %v, want %v", got, want)
+	}
+	if metadata["amount"] != 100.0 {
+		t.Error("redactField modified the original map")
+	}
+}
+
+func TestConfigureRedactsOutput(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	err := Configure(logger, config.LoggingConfig{LogLevel: "info", LogFormat: FormatJSON, LogRedact: allCategories})
+	if err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+
+	ctx := WithFields(context.Background(), logrus.Fields{"username": "alice"})
+	logger.WithContext(ctx).WithFields(logrus.Fields{
+		"email":    "alice@example.com",
+		"amount":   4321.77,
+		"metadata": map[string]interface{}{"token": "secret-token"},
+	}).Info("registered alice@example.com")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("decode %s: %v", buf.String(), err)
+	}
+	for _, leaked := range []string{"alice@example.com", "4321.77", "secret-token", `"alice"`} {
+		if strings.Contains(buf.String(), leaked) {
+			t.Errorf("log output contains %s: %s", leaked, buf.String())
+		}
+	}
+	if entry["username"] != "a***" || entry["msg"] != "registered a***@example.com" {
+		t.Errorf("entry = %v, want masked username and message", entry)
+	}
+}
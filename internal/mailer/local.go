@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FileMailer сохраняет каждое письмо в отдельный .eml файл.
+type FileMailer struct {
+	from   string
+	dir    string
+	logger *logrus.Logger
+}
+
+func NewFileMailer(from, dir string, logger *logrus.Logger) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{from: from, dir: dir, logger: logger}, nil
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	name := fmt.Sprintf("%d.eml", time.Now().UnixNano())
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, format(m.from, msg), 0o600); err != nil {
+		m.logger.WithField("path", path).WithError(err).Error("failed to write email file")
+		return err
+	}
+
+	m.logger.WithField("path", path).Info("email written to file")
+	return nil
+}
+
+// LogMailer пишет в лог только получателя и тему письма. Тело не
+// выводится: в нём ссылки с токенами подтверждения email и сброса пароля,
+// и любой с доступом к журналу мог бы ими воспользоваться. Для отладки
+// писем — FileMailer.
+type LogMailer struct {
+	from   string
+	logger *logrus.Logger
+}
+
+func NewLogMailer(from string, logger *logrus.Logger) *LogMailer {
+	return &LogMailer{from: from, logger: logger}
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	m.logger.WithFields(logrus.Fields{
+		"from":    m.from,
+		"to":      msg.To,
+		"subject": msg.Subject,
+	}).Info("email (log mailer, body omitted)")
+	return nil
+}
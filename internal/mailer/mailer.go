@@ -0,0 +1,38 @@
+package mailer
+
+import (
+	"fmt"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer отправляет письма пользователям. Для локального запуска без
+// почтового сервера есть реализации, пишущие письма в файлы или в лог.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+func New(cfg config.MailConfig, logger *logrus.Logger) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return NewSMTPMailer(cfg, logger), nil
+	case "file":
+		return NewFileMailer(cfg.From, cfg.FileDir, logger)
+	case "log", "":
+		return NewLogMailer(cfg.From, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
+
+func format(from string, msg Message) []byte {
+	return []byte(fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s\r\n",
+		from, msg.To, msg.Subject, msg.Body))
+}
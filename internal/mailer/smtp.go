@@ -0,0 +1,44 @@
+package mailer
+
+import (
+	"net"
+	"net/smtp"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+type SMTPMailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+	logger   *logrus.Logger
+}
+
+func NewSMTPMailer(cfg config.MailConfig, logger *logrus.Logger) *SMTPMailer {
+	return &SMTPMailer{
+		addr:     net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort),
+		host:     cfg.SMTPHost,
+		username: cfg.SMTPUsername,
+		password: cfg.SMTPPassword.Value(),
+		from:     cfg.From,
+		logger:   logger,
+	}
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	if err := smtp.SendMail(m.addr, auth, m.from, []string{msg.To}, format(m.from, msg)); err != nil {
+		m.logger.WithField("subject", msg.Subject).WithError(err).Error("failed to send email via SMTP")
+		return err
+	}
+
+	m.logger.WithField("subject", msg.Subject).Info("email sent via SMTP")
+	return nil
+}
@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+const namespace = "wallet"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	grpcClientDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_client_duration_seconds",
+		Help:      "Latency of outgoing gRPC calls by method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "code"})
+
+	grpcClientErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_client_errors_total",
+		Help:      "Failed outgoing gRPC calls by method and status code.",
+	}, []string{"method", "code"})
+
+	rateCache = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_cache_requests_total",
+		Help:      "Exchange rate cache lookups by result (hit or miss).",
+	}, []string{"result"})
+
+	walletOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "operations_total",
+		Help:      "Completed wallet operations by operation and currency.",
+	}, []string{"operation", "currency"})
+
+	walletVolume = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "operation_volume_total",
+		Help:      "Amount moved by completed wallet operations, in units of the currency.",
+	}, []string{"operation", "currency"})
+
+	webhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook delivery attempts by event type and result (delivered, retry or dead).",
+	}, []string{"event", "result"})
+
+	outboxPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbox_published_total",
+		Help:      "Outbox events by event type and publish result (published, failed or dead).",
+	}, []string{"event", "result"})
+)
+
+// Операции для бизнес-метрик. Обмен учитывается дважды: списанная валюта
+// как exchange_sold, зачисленная как exchange_bought.
+const (
+	OperationDeposit        = "deposit"
+	OperationWithdraw       = "withdraw"
+	OperationExchangeSold   = "exchange_sold"
+	OperationExchangeBought = "exchange_bought"
+)
+
+// RegisterDBStats экспортирует статистику пула соединений sql.DB.
+func RegisterDBStats(db *sql.DB) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, "wallet"))
+}
+
+// ObserveHTTPRequest учитывает завершённый HTTP-запрос. route — шаблон
+// маршрута gin (например, /api/v1/api-keys/:id), а не фактический путь,
+// чтобы число серий не зависело от параметров.
+func ObserveHTTPRequest(method, route string, status int, duration time.Duration) {
+	statusLabel := strconv.Itoa(status)
+	httpRequests.WithLabelValues(method, route, statusLabel).Inc()
+	httpDuration.WithLabelValues(method, route, statusLabel).Observe(duration.Seconds())
+}
+
+func RateCacheHit() {
+	rateCache.WithLabelValues("hit").Inc()
+}
+
+func RateCacheMiss() {
+	rateCache.WithLabelValues("miss").Inc()
+}
+
+func ObserveOperation(operation, currency string, amount float64) {
+	walletOperations.WithLabelValues(operation, currency).Inc()
+	walletVolume.WithLabelValues(operation, currency).Add(amount)
+}
+
+// Результаты попытки доставки вебхука
+const (
+	WebhookDelivered = "delivered"
+	WebhookRetry     = "retry"
+	WebhookDead      = "dead"
+)
+
+func ObserveWebhookDelivery(eventType, result string) {
+	webhookDeliveries.WithLabelValues(eventType, result).Inc()
+}
+
+// Результаты публикации события из outbox
+const (
+	OutboxPublished = "published"
+	OutboxFailed    = "failed"
+	OutboxDead      = "dead"
+)
+
+func ObserveOutboxPublish(eventType, result string) {
+	outboxPublished.WithLabelValues(eventType, result).Inc()
+}
+
+// UnaryClientInterceptor измеряет время и ошибки исходящих gRPC-вызовов.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+
+		code := status.Code(err).String()
+		grpcClientDuration.WithLabelValues(method, code).Observe(time.Since(start).Seconds())
+		if err != nil {
+			grpcClientErrors.WithLabelValues(method, code).Inc()
+		}
+		return err
+	}
+}
@@ -0,0 +1,46 @@
+package outbox
+
+import (
+	"context"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+)
+
+// filePublisher дописывает события в файл, по строке JSON на событие. Для
+// локального запуска без брокера; "-" — stdout.
+type filePublisher struct {
+	mu sync.Mutex
+	w  io.Writer
+	f  *os.File
+}
+
+func newFilePublisher(path string) (*filePublisher, error) {
+	if path == "-" {
+		return &filePublisher{w: os.Stdout}, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &filePublisher{w: f, f: f}, nil
+}
+
+func (p *filePublisher) Publish(_ context.Context, m storages.OutboxMessage) error {
+	line := make([]byte, 0, len(m.Payload)+1)
+	line = append(append(line, m.Payload...), '\n')
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := p.w.Write(line)
+	return err
+}
+
+func (p *filePublisher) Close() error {
+	if p.f == nil {
+		return nil
+	}
+	return p.f.Close()
+}
@@ -0,0 +1,44 @@
+package outbox
+
+import (
+	"context"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaPublisher пишет события в топик с ключом — идентификатором
+// пользователя. События одного пользователя попадают в одну партицию и
+// читаются в том порядке, в каком записаны.
+type kafkaPublisher struct {
+	writer *kafka.Writer
+}
+
+func newKafkaPublisher(cfg config.OutboxKafkaConfig) *kafkaPublisher {
+	return &kafkaPublisher{writer: &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Topic:        cfg.Topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		// Relay пишет по одному сообщению и ждёт подтверждения; без этого
+		// writer копил бы пачку до BatchTimeout.
+		BatchSize: 1,
+	}}
+}
+
+func (p *kafkaPublisher) Publish(ctx context.Context, m storages.OutboxMessage) error {
+	return p.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(m.Key),
+		Value: m.Payload,
+		Time:  m.CreatedAt,
+		Headers: []kafka.Header{
+			{Key: HeaderEventID, Value: []byte(m.EventID)},
+			{Key: HeaderEventType, Value: []byte(m.Type)},
+		},
+	})
+}
+
+func (p *kafkaPublisher) Close() error {
+	return p.writer.Close()
+}
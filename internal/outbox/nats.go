@@ -0,0 +1,55 @@
+package outbox
+
+import (
+	"context"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+	"github.com/nats-io/nats.go"
+	"github.com/sirupsen/logrus"
+)
+
+// natsPublisher публикует события в JetStream. Идентификатор события
+// передаётся как Nats-Msg-Id: повтор после сбоя отбрасывается самим
+// JetStream в пределах окна дедупликации потока.
+type natsPublisher struct {
+	conn    *nats.Conn
+	js      nats.JetStreamContext
+	subject string
+}
+
+func newNATSPublisher(cfg config.OutboxNATSConfig, logger *logrus.Logger) (*natsPublisher, error) {
+	conn, err := nats.Connect(cfg.URL,
+		nats.Name("gw-currency-wallet"),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			logger.WithError(err).Warn("disconnected from NATS")
+		}),
+		nats.ReconnectHandler(func(*nats.Conn) {
+			logger.Info("reconnected to NATS")
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &natsPublisher{conn: conn, js: js, subject: cfg.Subject}, nil
+}
+
+func (p *natsPublisher) Publish(ctx context.Context, m storages.OutboxMessage) error {
+	msg := nats.NewMsg(p.subject + "." + m.Type)
+	msg.Data = m.Payload
+	msg.Header.Set(nats.MsgIdHdr, m.EventID)
+	msg.Header.Set(HeaderEventType, m.Type)
+	msg.Header.Set("user-id", m.Key)
+	_, err := p.js.PublishMsg(msg, nats.Context(ctx))
+	return err
+}
+
+func (p *natsPublisher) Close() error {
+	return p.conn.Drain()
+}
@@ -0,0 +1,38 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+	"github.com/sirupsen/logrus"
+)
+
+// Заголовки сообщения в брокере. Тело — storages.Event в JSON.
+const (
+	HeaderEventID   = "event-id"
+	HeaderEventType = "event-type"
+)
+
+// Publisher — брокер, в который публикуются события. Publish возвращает
+// управление, только когда брокер подтвердил запись: после этого событие
+// отмечается в outbox опубликованным.
+type Publisher interface {
+	Publish(ctx context.Context, m storages.OutboxMessage) error
+	Close() error
+}
+
+// NewPublisher создаёт Publisher для cfg.Broker.
+func NewPublisher(cfg config.OutboxConfig, logger *logrus.Logger) (Publisher, error) {
+	switch cfg.Broker {
+	case "kafka":
+		return newKafkaPublisher(cfg.Kafka), nil
+	case "nats":
+		return newNATSPublisher(cfg.NATS, logger)
+	case "file":
+		return newFilePublisher(cfg.File)
+	default:
+		return nil, fmt.Errorf("unknown outbox broker %q", cfg.Broker)
+	}
+}
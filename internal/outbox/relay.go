@@ -0,0 +1,227 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"github.com/Krchnk/gw-currency-wallet/internal/metrics"
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+	"github.com/sirupsen/logrus"
+)
+
+// cleanupInterval — как часто удалять опубликованные события старше Retention.
+const cleanupInterval = time.Hour
+
+// maxFailureDelay ограничивает паузу между опросами, пока база недоступна.
+const maxFailureDelay = time.Minute
+
+// maxRetryDelay ограничивает паузу перед повторной публикацией события.
+const maxRetryDelay = time.Hour
+
+// maxErrorLength ограничивает текст ошибки, который сохраняется в outbox.
+const maxErrorLength = 500
+
+// Store — таблица outbox, её реализует postgres.Storage.
+type Store interface {
+	LockOutbox(ctx context.Context) (storages.OutboxLock, error)
+	DeletePublishedOutbox(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Relay переносит события из outbox в брокер. Доставка «хотя бы один
+// раз»: потребители отбрасывают повторы по идентификатору события. Порядок
+// сохраняется для событий одного пользователя: если публикация события не
+// удалась, следующие события того же пользователя ждут её повтора, а
+// события остальных пользователей публикуются дальше. После MaxAttempts
+// неудач событие уходит в dead letter, и очередь пользователя движется.
+type Relay struct {
+	store     Store
+	publisher Publisher
+	cfg       config.OutboxConfig
+	logger    *logrus.Logger
+}
+
+func NewRelay(store Store, publisher Publisher, cfg config.OutboxConfig, logger *logrus.Logger) *Relay {
+	return &Relay{
+		store:     store,
+		publisher: publisher,
+		cfg:       cfg,
+		logger:    logger,
+	}
+}
+
+// Run публикует события до отмены ctx. Публикует только экземпляр,
+// получивший OutboxLock; остальные раз в PollInterval пробуют его взять.
+// Пока база недоступна, пауза между опросами растёт вдвое, до
+// maxFailureDelay; неудачные публикации откладываются по отдельности (см.
+// retryDelay). После отмены ctx новые события не публикуются, а уже
+// опубликованные отмечаются.
+func (r *Relay) Run(ctx context.Context) {
+	delay := r.cfg.PollInterval
+	var lastCleanup time.Time
+	var lock storages.OutboxLock
+	defer func() {
+		if lock != nil {
+			lock.Release()
+		}
+	}()
+
+	for {
+		if r.cfg.Retention > 0 && time.Since(lastCleanup) >= cleanupInterval {
+			r.cleanup(ctx)
+			lastCleanup = time.Now()
+		}
+
+		ok := true
+		if lock == nil {
+			lock, ok = r.lock(ctx)
+		}
+		if lock != nil {
+			if err := r.publishPending(ctx, lock); err != nil {
+				// Соединение с lock могло оборваться: берём его заново.
+				if ctx.Err() == nil {
+					r.logger.WithError(err).Error("failed to publish outbox events")
+				}
+				lock.Release()
+				lock = nil
+				ok = false
+			}
+		}
+
+		if ok {
+			delay = r.cfg.PollInterval
+		} else {
+			delay = min(delay*2, maxFailureDelay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// lock пробует стать публикующим экземпляром. ok == false — ошибка базы.
+func (r *Relay) lock(ctx context.Context) (storages.OutboxLock, bool) {
+	lock, err := r.store.LockOutbox(ctx)
+	switch {
+	case err == nil:
+		r.logger.Info("outbox relay is now publishing")
+		return lock, true
+	case errors.Is(err, storages.ErrOutboxLocked):
+		return nil, true
+	default:
+		if ctx.Err() == nil {
+			r.logger.WithError(err).Error("failed to take outbox lock")
+		}
+		return nil, false
+	}
+}
+
+// publishPending публикует готовые события пачками по BatchSize. Событие,
+// которое не опубликовалось, и следующие события его пользователя не
+// попадают в пачки до срока повтора, так что остальные пользователи его не
+// ждут. Ошибка — только ошибка базы.
+func (r *Relay) publishPending(ctx context.Context, lock storages.OutboxLock) error {
+	for ctx.Err() == nil {
+		messages, err := lock.Pending(ctx, r.cfg.BatchSize)
+		if err != nil {
+			return err
+		}
+		if err := r.publishBatch(ctx, lock, messages); err != nil {
+			return err
+		}
+		if len(messages) < r.cfg.BatchSize {
+			return nil
+		}
+	}
+	return nil
+}
+
+// publishBatch публикует пачку и отмечает результат в outbox. Отметки
+// пишутся без ctx сервиса, чтобы при остановке опубликованное не ушло
+// повторно.
+func (r *Relay) publishBatch(ctx context.Context, lock storages.OutboxLock, messages []storages.OutboxMessage) error {
+	var published []int64
+	var errs []error
+	blocked := make(map[string]bool)
+
+	for _, m := range messages {
+		if ctx.Err() != nil {
+			break
+		}
+		if blocked[m.Key] {
+			continue
+		}
+
+		publishCtx, cancel := context.WithTimeout(context.Background(), r.cfg.PublishTimeout)
+		err := r.publisher.Publish(publishCtx, m)
+		cancel()
+		if err == nil {
+			metrics.ObserveOutboxPublish(m.Type, metrics.OutboxPublished)
+			published = append(published, m.ID)
+			continue
+		}
+
+		attempt := m.Attempts + 1
+		log := r.logger.WithFields(logrus.Fields{
+			"outbox_id":  m.ID,
+			"event_id":   m.EventID,
+			"event_type": m.Type,
+			"attempt":    attempt,
+		}).WithError(err)
+		reason := err.Error()
+		if len(reason) > maxErrorLength {
+			reason = reason[:maxErrorLength]
+		}
+
+		if attempt >= r.cfg.MaxAttempts {
+			metrics.ObserveOutboxPublish(m.Type, metrics.OutboxDead)
+			log.Error("failed to publish outbox event, moved to dead letter")
+			err = lock.MarkDead(context.Background(), m.ID, reason)
+		} else {
+			blocked[m.Key] = true
+			metrics.ObserveOutboxPublish(m.Type, metrics.OutboxFailed)
+			log.Warn("failed to publish outbox event, will retry")
+			err = lock.MarkFailed(context.Background(), m.ID, reason, r.retryDelay(attempt))
+		}
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+	}
+
+	if len(published) > 0 {
+		if err := lock.MarkPublished(context.Background(), published); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// retryDelay — пауза перед повтором после attempt неудач: PollInterval,
+// дальше вдвое больше после каждой неудачи, до maxRetryDelay.
+func (r *Relay) retryDelay(attempt int) time.Duration {
+	delay := r.cfg.PollInterval
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+func (r *Relay) cleanup(ctx context.Context) {
+	deleted, err := r.store.DeletePublishedOutbox(ctx, time.Now().Add(-r.cfg.Retention))
+	if err != nil {
+		if ctx.Err() == nil {
+			r.logger.WithError(err).Error("failed to delete published outbox events")
+		}
+		return
+	}
+	if deleted > 0 {
+		r.logger.WithField("deleted", deleted).Info("published outbox events deleted")
+	}
+}
@@ -0,0 +1,185 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+	"github.com/sirupsen/logrus"
+)
+
+// memLock — outbox в памяти. Отложенные события и события после них в
+// пределах ключа пропускаются, как в postgres.
+type memLock struct {
+	rows      []storages.OutboxMessage
+	published map[int64]bool
+	dead      map[int64]bool
+	failures  map[int64]int
+	retryAt   map[int64]time.Time
+}
+
+func newMemLock(keys ...string) *memLock {
+	l := &memLock{
+		published: map[int64]bool{},
+		dead:      map[int64]bool{},
+		failures:  map[int64]int{},
+		retryAt:   map[int64]time.Time{},
+	}
+	for i, key := range keys {
+		l.rows = append(l.rows, storages.OutboxMessage{ID: int64(i + 1), Key: key})
+	}
+	return l
+}
+
+func (l *memLock) Pending(_ context.Context, limit int) ([]storages.OutboxMessage, error) {
+	var pending []storages.OutboxMessage
+	waiting := map[string]bool{}
+	for _, m := range l.rows {
+		if l.published[m.ID] || l.dead[m.ID] {
+			continue
+		}
+		if time.Now().Before(l.retryAt[m.ID]) {
+			waiting[m.Key] = true
+		}
+		if !waiting[m.Key] && len(pending) < limit {
+			m.Attempts = l.failures[m.ID]
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+func (l *memLock) MarkPublished(_ context.Context, ids []int64) error {
+	for _, id := range ids {
+		l.published[id] = true
+	}
+	return nil
+}
+
+func (l *memLock) MarkFailed(_ context.Context, id int64, _ string, retryAfter time.Duration) error {
+	l.failures[id]++
+	l.retryAt[id] = time.Now().Add(retryAfter)
+	return nil
+}
+
+func (l *memLock) MarkDead(_ context.Context, id int64, _ string) error {
+	l.failures[id]++
+	l.dead[id] = true
+	return nil
+}
+
+func (l *memLock) Release() {}
+
+type flakyPublisher struct {
+	failures map[int64]int // сколько раз не публиковать событие
+	got      []storages.OutboxMessage
+}
+
+func (p *flakyPublisher) Publish(_ context.Context, m storages.OutboxMessage) error {
+	if p.failures[m.ID] > 0 {
+		p.failures[m.ID]--
+		return errors.New("broker unavailable")
+	}
+	p.got = append(p.got, m)
+	return nil
+}
+
+func (p *flakyPublisher) Close() error { return nil }
+
+func newTestRelay(publisher Publisher, cfg config.OutboxConfig) *Relay {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	cfg.PublishTimeout = time.Second
+	return NewRelay(nil, publisher, cfg, logger)
+}
+
+func TestPublishPendingKeepsOrderPerKey(t *testing.T) {
+	lock := newMemLock("a", "b", "a", "b", "a")
+	publisher := &flakyPublisher{failures: map[int64]int{1: 2}}
+	relay := newTestRelay(publisher, config.OutboxConfig{BatchSize: 2, MaxAttempts: 10, PollInterval: time.Nanosecond})
+
+	for range 5 {
+		if err := relay.publishPending(context.Background(), lock); err != nil {
+			t.Fatalf("publishPending: %v", err)
+		}
+	}
+
+	perKey := map[string][]int64{}
+	for _, m := range publisher.got {
+		perKey[m.Key] = append(perKey[m.Key], m.ID)
+	}
+	if want := []int64{1, 3, 5}; !slices.Equal(perKey["a"], want) {
+		t.Errorf("key a published %v, want %v", perKey["a"], want)
+	}
+	if want := []int64{2, 4}; !slices.Equal(perKey["b"], want) {
+		t.Errorf("key b published %v, want %v", perKey["b"], want)
+	}
+	if lock.failures[1] != 2 {
+		t.Errorf("event 1 failures recorded %d, want 2", lock.failures[1])
+	}
+	if len(lock.failures) != 1 {
+		t.Errorf("failures recorded for %v, want only event 1", lock.failures)
+	}
+}
+
+// Отложенный ключ с событиями на несколько пачек не задерживает остальные.
+func TestPublishPendingSkipsWaitingKey(t *testing.T) {
+	lock := newMemLock("a", "a", "a", "a", "b", "c")
+	publisher := &flakyPublisher{failures: map[int64]int{1: 1}}
+	relay := newTestRelay(publisher, config.OutboxConfig{BatchSize: 2, MaxAttempts: 10, PollInterval: time.Hour})
+
+	if err := relay.publishPending(context.Background(), lock); err != nil {
+		t.Fatalf("publishPending: %v", err)
+	}
+
+	var got []int64
+	for _, m := range publisher.got {
+		got = append(got, m.ID)
+	}
+	if want := []int64{5, 6}; !slices.Equal(got, want) {
+		t.Errorf("published %v, want %v", got, want)
+	}
+}
+
+func TestPublishBatchMovesToDeadLetter(t *testing.T) {
+	lock := newMemLock("a", "a")
+	publisher := &flakyPublisher{failures: map[int64]int{1: 100}}
+	relay := newTestRelay(publisher, config.OutboxConfig{BatchSize: 10, MaxAttempts: 3, PollInterval: time.Nanosecond})
+
+	for range 5 {
+		if err := relay.publishPending(context.Background(), lock); err != nil {
+			t.Fatalf("publishPending: %v", err)
+		}
+	}
+
+	if !lock.dead[1] || lock.failures[1] != 3 {
+		t.Errorf("event 1 dead=%v after %d failures, want dead after 3", lock.dead[1], lock.failures[1])
+	}
+	if !lock.published[2] {
+		t.Error("event 2 is still blocked by the dead event")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	relay := newTestRelay(nil, config.OutboxConfig{PollInterval: time.Second})
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{13, maxRetryDelay},
+		{1000, maxRetryDelay},
+	}
+	for _, tt := range tests {
+		if got := relay.retryDelay(tt.attempt); got != tt.want {
+			t.Errorf("retryDelay(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
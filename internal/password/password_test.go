@@ -0,0 +1,119 @@
+package password
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Параметры занижены, чтобы тесты шли быстро.
+var (
+	argon2Config = config.PasswordHashConfig{Algorithm: AlgorithmArgon2id, Argon2Memory: 64, Argon2Iterations: 1, Argon2Parallelism: 1}
+	bcryptConfig = config.PasswordHashConfig{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost}
+)
+
+func newHasher(t *testing.T, cfg config.PasswordHashConfig) *Hasher {
+	t.Helper()
+	h, err := NewHasher(cfg)
+	if err != nil {
+		t.Fatalf("NewHasher: %v", err)
+	}
+	return h
+}
+
+func TestHashVerifyRoundTrip(t *testing.T) {
+	for _, cfg := range []config.PasswordHashConfig{argon2Config, bcryptConfig} {
+		t.Run(cfg.Algorithm, func(t *testing.T) {
+			h := newHasher(t, cfg)
+			encoded, err := h.Hash("correct horse")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+
+			ok, needsRehash, err := h.Verify("correct horse", encoded)
+			if err != nil || !ok || needsRehash {
+				t.Errorf("Verify(correct) = %v, %v, %v; want true, false, nil", ok, needsRehash, err)
+			}
+			ok, _, err = h.Verify("wrong horse", encoded)
+			if err != nil || ok {
+				t.Errorf("Verify(wrong) = %v, %v; want false, nil", ok, err)
+			}
+		})
+	}
+}
+
+// Хэш с другим алгоритмом или параметрами подходит, но требует пересчёта.
+func TestVerifyNeedsRehash(t *testing.T) {
+	stronger := argon2Config
+	stronger.Argon2Iterations = 2
+	strongerBcrypt := bcryptConfig
+	strongerBcrypt.BcryptCost = bcrypt.MinCost + 1
+
+	tests := []struct {
+		name     string
+		hashWith config.PasswordHashConfig
+		verifyBy config.PasswordHashConfig
+	}{
+		{"bcrypt to argon2id", bcryptConfig, argon2Config},
+		{"argon2id to bcrypt", argon2Config, bcryptConfig},
+		{"argon2id parameters raised", argon2Config, stronger},
+		{"bcrypt cost raised", bcryptConfig, strongerBcrypt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := newHasher(t, tt.hashWith).Hash("secret")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			ok, needsRehash, err := newHasher(t, tt.verifyBy).Verify("secret", encoded)
+			if err != nil || !ok || !needsRehash {
+				t.Errorf("Verify = %v, %v, %v; want true, true, nil", ok, needsRehash, err)
+			}
+		})
+	}
+}
+
+// Хэш в формате PHC, собранный вручную, проверяется с параметрами из строки.
+func TestVerifyPHCString(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	key := argon2.IDKey([]byte("secret"), salt, 2, 128, 2, 32)
+	encoded := fmt.Sprintf("$argon2id$v=19$m=128,t=2,p=2$%s$%s",
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+
+	ok, needsRehash, err := newHasher(t, argon2Config).Verify("secret", encoded)
+	if err != nil || !ok || !needsRehash {
+		t.Errorf("Verify = %v, %v, %v; want true, true, nil", ok, needsRehash, err)
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	h := newHasher(t, argon2Config)
+	tests := []struct {
+		name    string
+		encoded string
+		unknown bool
+	}{
+		{"plain text", "secret", true},
+		{"too few parts", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA", true},
+		{"wrong version", "$argon2id$v=16$m=64,t=1,p=1$c2FsdA$aGFzaA", false},
+		{"bad parameters", "$argon2id$v=19$m=x,t=1,p=1$c2FsdA$aGFzaA", false},
+		{"bad salt", "$argon2id$v=19$m=64,t=1,p=1$!!!$aGFzaA", false},
+		{"bad hash", "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$!!!", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, _, err := h.Verify("secret", tt.encoded)
+			if ok || err == nil {
+				t.Fatalf("Verify = %v, %v; want false and an error", ok, err)
+			}
+			if errors.Is(err, ErrUnknownHashFormat) != tt.unknown {
+				t.Errorf("Verify error = %v, ErrUnknownHashFormat expected: %v", err, tt.unknown)
+			}
+		})
+	}
+}
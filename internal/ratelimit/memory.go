@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"github.com/patrickmn/go-cache"
+)
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryStore держит корзины в памяти процесса. Лимит действует только
+// в пределах одной реплики.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets *cache.Cache
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: cache.New(cache.NoExpiration, cleanupInterval),
+	}
+}
+
+func (m *MemoryStore) Take(_ context.Context, key string, policy config.RateLimitPolicy) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	b := bucket{tokens: float64(policy.Burst), updated: now}
+	if cached, found := m.buckets.Get(key); found {
+		b = cached.(bucket)
+	}
+
+	tokens, res := Take(b.tokens, now.Sub(b.updated).Seconds(), policy)
+
+	// Полная корзина ничем не отличается от отсутствующей, поэтому запись
+	// живёт ровно до момента полного восстановления.
+	m.buckets.Set(key, bucket{tokens: tokens, updated: now}, res.Reset+time.Second)
+	return res, nil
+}
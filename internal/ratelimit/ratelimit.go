@@ -0,0 +1,205 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/apierror"
+	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Store хранит состояние token bucket'ов. Take должен атомарно списать
+// один токен по ключу, чтобы несколько реплик могли делить один лимит.
+type Store interface {
+	Take(ctx context.Context, key string, policy config.RateLimitPolicy) (Result, error)
+}
+
+// Cleaner — хранилище, записи которого не удаляются сами; его реализует
+// postgres.RateLimitStore.
+type Cleaner interface {
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// cleanupInterval — как часто Cleaner удаляет восстановившиеся корзины;
+// так же часто MemoryStore вычищает просроченные записи.
+const cleanupInterval = 10 * time.Minute
+
+// RunCleanup удаляет восстановившиеся корзины раз в cleanupInterval до
+// отмены ctx.
+func RunCleanup(ctx context.Context, cleaner Cleaner, logger *logrus.Logger) {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		deleted, err := cleaner.DeleteExpired(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.WithError(err).Error("failed to clean up rate limit buckets")
+			}
+			continue
+		}
+		if deleted > 0 {
+			logger.WithField("deleted", deleted).Debug("expired rate limit buckets deleted")
+		}
+	}
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+// KeyFunc возвращает ключ, по которому считается лимит для запроса.
+type KeyFunc func(c *gin.Context) string
+
+func KeyByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// KeyByUser использует user_id, выставленный AuthMiddleware, и
+// откатывается на IP для неаутентифицированных запросов.
+func KeyByUser(c *gin.Context) string {
+	if userID := c.GetString("user_id"); userID != "" {
+		return UserKey(userID)
+	}
+	return KeyByIP(c)
+}
+
+// UserKey — ключ лимита пользователя. Он одинаков для REST и gRPC, так что
+// оба API расходуют одну корзину.
+func UserKey(userID string) string {
+	return "user:" + userID
+}
+
+// Take пополняет корзину за прошедшие elapsed секунд и пытается списать
+// один токен. Возвращает новое количество токенов и результат проверки.
+func Take(tokens, elapsed float64, policy config.RateLimitPolicy) (float64, Result) {
+	burst := float64(policy.Burst)
+	tokens = math.Min(burst, tokens+elapsed*policy.Rate)
+
+	res := Result{Limit: policy.Burst}
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else if policy.Rate > 0 {
+		res.RetryAfter = secondsToDuration((1 - tokens) / policy.Rate)
+	}
+
+	res.Remaining = int(tokens)
+	if policy.Rate > 0 {
+		res.Reset = secondsToDuration((burst - tokens) / policy.Rate)
+	}
+	return tokens, res
+}
+
+// Limit хранит текущую политику лимита. Политику можно заменить на лету,
+// например при перечитывании конфигурации.
+type Limit struct {
+	policy atomic.Pointer[config.RateLimitPolicy]
+}
+
+func NewLimit(policy config.RateLimitPolicy) *Limit {
+	l := &Limit{}
+	l.Set(policy)
+	return l
+}
+
+func (l *Limit) Set(policy config.RateLimitPolicy) {
+	l.policy.Store(&policy)
+}
+
+func (l *Limit) Policy() config.RateLimitPolicy {
+	return *l.policy.Load()
+}
+
+// Middleware ограничивает частоту запросов по ключу keyFunc. Ключи разных
+// политик не пересекаются благодаря префиксу name. При ошибке хранилища
+// запрос пропускается, чтобы сбой лимитера не положил API.
+func Middleware(store Store, name string, limit *Limit, keyFunc KeyFunc, logger *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := name + ":" + keyFunc(c)
+		policy := limit.Policy()
+
+		res, err := store.Take(c.Request.Context(), key, policy)
+		if err != nil {
+			logger.WithContext(c.Request.Context()).WithField("key", key).WithError(err).Error("rate limiter failed, allowing request")
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+		if !res.Allowed {
+			retryAfter := ceilSeconds(res.RetryAfter)
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			logger.WithContext(c.Request.Context()).WithFields(logrus.Fields{
+				"key":         key,
+				"retry_after": retryAfter,
+			}).Warn("rate limit exceeded")
+			apierror.Respond(c, http.StatusTooManyRequests, apierror.CodeRateLimited, "Too many requests")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// UnaryServerInterceptor — Middleware для gRPC. keyFunc возвращает "" для
+// методов без лимита (health, reflection). Превышение — RESOURCE_EXHAUSTED
+// с метаданными retry-after.
+func UnaryServerInterceptor(store Store, name string, limit *Limit, keyFunc func(ctx context.Context) string, logger *logrus.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		subject := keyFunc(ctx)
+		if subject == "" {
+			return handler(ctx, req)
+		}
+		key := name + ":" + subject
+
+		res, err := store.Take(ctx, key, limit.Policy())
+		if err != nil {
+			logger.WithContext(ctx).WithField("key", key).WithError(err).Error("rate limiter failed, allowing request")
+			return handler(ctx, req)
+		}
+		if !res.Allowed {
+			retryAfter := max(ceilSeconds(res.RetryAfter), 1)
+			_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(retryAfter)))
+			logger.WithContext(ctx).WithFields(logrus.Fields{
+				"key":         key,
+				"method":      info.FullMethod,
+				"retry_after": retryAfter,
+			}).Warn("rate limit exceeded")
+			return nil, status.Error(codes.ResourceExhausted, "too many requests")
+		}
+		return handler(ctx, req)
+	}
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
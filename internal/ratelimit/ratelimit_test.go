@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/apierror"
+	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func TestTake(t *testing.T) {
+	policy := config.RateLimitPolicy{Rate: 2, Burst: 5}
+	tests := []struct {
+		name       string
+		tokens     float64
+		elapsed    float64
+		policy     config.RateLimitPolicy
+		wantTokens float64
+		want       Result
+	}{
+		{
+			name: "full bucket", tokens: 5, policy: policy,
+			wantTokens: 4,
+			want:       Result{Allowed: true, Limit: 5, Remaining: 4, Reset: 500 * time.Millisecond},
+		},
+		{
+			name: "refill is capped by burst", tokens: 0, elapsed: 60, policy: policy,
+			wantTokens: 4,
+			want:       Result{Allowed: true, Limit: 5, Remaining: 4, Reset: 500 * time.Millisecond},
+		},
+		{
+			name: "partial refill", tokens: 0, elapsed: 0.75, policy: policy,
+			wantTokens: 0.5,
+			want:       Result{Allowed: true, Limit: 5, Remaining: 0, Reset: 2250 * time.Millisecond},
+		},
+		{
+			name: "empty bucket", tokens: 0.5, policy: policy,
+			wantTokens: 0.5,
+			want:       Result{Limit: 5, Remaining: 0, RetryAfter: 250 * time.Millisecond, Reset: 2250 * time.Millisecond},
+		},
+		{
+			name: "zero rate never refills", tokens: 0, elapsed: 3600, policy: config.RateLimitPolicy{Burst: 1},
+			wantTokens: 0,
+			want:       Result{Limit: 1, Remaining: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, res := Take(tt.tokens, tt.elapsed, tt.policy)
+			if tokens != tt.wantTokens {
+				t.Errorf("tokens = %v, want %v", tokens, tt.wantTokens)
+			}
+			if res != tt.want {
+				t.Errorf("result = %+v, want %+v", res, tt.want)
+			}
+		})
+	}
+}
+
+func newTestRouter(policy config.RateLimitPolicy) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	r := gin.New()
+	r.Use(Middleware(NewMemoryStore(), "test", NewLimit(policy), KeyByIP, logger))
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	return r
+}
+
+func TestMiddleware(t *testing.T) {
+	r := newTestRouter(config.RateLimitPolicy{Rate: 0.1, Burst: 2})
+
+	do := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for i, remaining := range []string{"1", "0"} {
+		w := do()
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("request %d: status = %d, want %d", i+1, w.Code, http.StatusNoContent)
+		}
+		if got := w.Header().Get("X-RateLimit-Limit"); got != "2" {
+			t.Errorf("request %d: X-RateLimit-Limit = %q, want 2", i+1, got)
+		}
+		if got := w.Header().Get("X-RateLimit-Remaining"); got != remaining {
+			t.Errorf("request %d: X-RateLimit-Remaining = %q, want %s", i+1, got, remaining)
+		}
+		if w.Header().Get("Retry-After") != "" {
+			t.Errorf("request %d: unexpected Retry-After", i+1)
+		}
+	}
+
+	w := do()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != "10" {
+		t.Errorf("Retry-After = %q, want 10", got)
+	}
+	if got := w.Header().Get("X-RateLimit-Reset"); got != "20" {
+		t.Errorf("X-RateLimit-Reset = %q, want 20", got)
+	}
+	if got := w.Header().Get("Content-Type"); got != apierror.ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, apierror.ContentType)
+	}
+
+	var problem apierror.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if problem.Status != http.StatusTooManyRequests || problem.Code != apierror.CodeRateLimited {
+		t.Errorf("problem = %+v, want status 429 and code %s", problem, apierror.CodeRateLimited)
+	}
+}
+
+func TestMiddlewareSeparatesKeys(t *testing.T) {
+	r := newTestRouter(config.RateLimitPolicy{Rate: 0.1, Burst: 1})
+
+	for _, addr := range []string{"192.0.2.1:1234", "192.0.2.2:1234"} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = addr
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusNoContent {
+			t.Errorf("%s: status = %d, want %d", addr, w.Code, http.StatusNoContent)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Header — заголовок HTTP, MetadataKey — ключ метаданных gRPC.
+const (
+	Header      = "X-Request-ID"
+	MetadataKey = "x-request-id"
+)
+
+// maxLength ограничивает чужой идентификатор, чтобы он не раздувал журнал.
+const maxLength = 128
+
+type contextKey struct{}
+
+// NewContext возвращает контекст с идентификатором запроса.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext возвращает идентификатор запроса или пустую строку.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// New генерирует случайный идентификатор.
+func New() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// Valid проверяет идентификатор, пришедший от клиента: непустой, не длиннее
+// maxLength и только из букв, цифр и символов -_.:
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func accept(id string) string {
+	if Valid(id) {
+		return id
+	}
+	return New()
+}
+
+// Middleware берёт X-Request-ID из запроса или генерирует новый, кладёт его
+// в контекст запроса и возвращает в ответе.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := accept(c.GetHeader(Header))
+
+		c.Set("request_id", id)
+		c.Request = c.Request.WithContext(NewContext(c.Request.Context(), id))
+		c.Header(Header, id)
+
+		c.Next()
+	}
+}
+
+// UnaryServerInterceptor делает то же для входящих gRPC-вызовов: берёт
+// x-request-id из метаданных или генерирует и отправляет его в заголовках
+// ответа.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var incoming string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(MetadataKey); len(values) > 0 {
+				incoming = values[0]
+			}
+		}
+		id := accept(incoming)
+
+		_ = grpc.SetHeader(ctx, metadata.Pairs(MetadataKey, id))
+		return handler(NewContext(ctx, id), req)
+	}
+}
+
+// UnaryClientInterceptor передаёт идентификатор запроса вызываемому
+// gRPC-сервису в метаданных x-request-id.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if id := FromContext(ctx); id != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, MetadataKey, id)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// LogrusHook добавляет request_id в записи, созданные через WithContext.
+type LogrusHook struct{}
+
+func (LogrusHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (LogrusHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	if id := FromContext(entry.Context); id != "" {
+		entry.Data["request_id"] = id
+	}
+	return nil
+}
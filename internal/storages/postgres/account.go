@@ -0,0 +1,192 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *Storage) GetUserByEmail(ctx context.Context, email string) (storages.User, error) {
+	var user storages.User
+	err := s.db.QueryRowContext(ctx, `
+        SELECT id, username, password_hash, email, email_verified_at IS NOT NULL, token_version, is_admin
+        FROM users
+        WHERE email = $1`,
+		email).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Email, &user.EmailVerified, &user.TokenVersion, &user.IsAdmin)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			s.logger.WithContext(ctx).Error("user not found by email")
+			return storages.User{}, errors.New("user not found")
+		}
+		s.logger.WithContext(ctx).WithError(err).Error("failed to get user by email")
+		return storages.User{}, err
+	}
+
+	return user, nil
+}
+
+func (s *Storage) MarkEmailVerified(ctx context.Context, userID string) error {
+	_, err := s.db.ExecContext(ctx, `
+        UPDATE users
+        SET email_verified_at = COALESCE(email_verified_at, NOW())
+        WHERE id = $1`,
+		userID)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to mark email verified")
+		return err
+	}
+
+	s.logger.WithContext(ctx).WithField("user_id", userID).Info("email verified in database")
+	return nil
+}
+
+// UpdatePassword меняет пароль, увеличивает token_version и отзывает все
+// сессии пользователя, тем самым делая недействительными выданные JWT.
+func (s *Storage) UpdatePassword(ctx context.Context, userID, passwordHash string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to begin transaction for password update")
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+        UPDATE users
+        SET password_hash = $2, token_version = token_version + 1
+        WHERE id = $1`,
+		userID, passwordHash)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to update password")
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        UPDATE sessions
+        SET revoked_at = NOW()
+        WHERE user_id = $1 AND revoked_at IS NULL`,
+		userID)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to revoke sessions on password update")
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to commit password update transaction")
+		return err
+	}
+
+	s.logger.WithContext(ctx).WithField("user_id", userID).Info("password updated in database")
+	return nil
+}
+
+// UpgradePasswordHash заменяет хэш того же пароля на посчитанный с новыми
+// параметрами. Сессии не отзываются; если пароль успели сменить, ничего
+// не происходит.
+func (s *Storage) UpgradePasswordHash(ctx context.Context, userID, oldHash, newHash string) error {
+	_, err := s.db.ExecContext(ctx, `
+        UPDATE users
+        SET password_hash = $3
+        WHERE id = $1 AND password_hash = $2`,
+		userID, oldHash, newHash)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to upgrade password hash")
+		return err
+	}
+
+	s.logger.WithContext(ctx).WithField("user_id", userID).Info("password hash upgraded in database")
+	return nil
+}
+
+func (s *Storage) GetTokenVersion(ctx context.Context, userID string) (int, error) {
+	var version int
+	err := s.db.QueryRowContext(ctx, `
+        SELECT token_version
+        FROM users
+        WHERE id = $1`,
+		userID).Scan(&version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			s.logger.WithContext(ctx).WithField("user_id", userID).Error("user not found")
+			return 0, errors.New("user not found")
+		}
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to get token version")
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// CreateUserToken сохраняет хэш одноразового токена. Срок действия
+// считается по часам базы. Прежние неиспользованные токены того же
+// назначения при этом отзываются.
+func (s *Storage) CreateUserToken(ctx context.Context, userID, purpose, tokenHash string, ttl time.Duration) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to begin transaction for user token")
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+        UPDATE user_tokens
+        SET used_at = NOW()
+        WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`,
+		userID, purpose)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to revoke previous user tokens")
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at, created_at)
+        VALUES ($1, $2, $3, NOW() + make_interval(secs => $4), NOW())`,
+		userID, purpose, tokenHash, ttl.Seconds())
+	if err != nil {
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"user_id": userID,
+			"purpose": purpose,
+		}).WithError(err).Error("failed to create user token")
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to commit user token transaction")
+		return err
+	}
+
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"user_id": userID,
+		"purpose": purpose,
+	}).Info("user token created in database")
+	return nil
+}
+
+// ConsumeUserToken помечает токен использованным и возвращает id
+// пользователя. Просроченные и уже использованные токены не принимаются.
+func (s *Storage) ConsumeUserToken(ctx context.Context, purpose, tokenHash string) (string, error) {
+	var userID string
+	err := s.db.QueryRowContext(ctx, `
+        UPDATE user_tokens
+        SET used_at = NOW()
+        WHERE purpose = $1 AND token_hash = $2 AND used_at IS NULL AND expires_at > NOW()
+        RETURNING user_id`,
+		purpose, tokenHash).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			s.logger.WithContext(ctx).WithField("purpose", purpose).Error("user token invalid, expired or used")
+			return "", storages.ErrTokenInvalid
+		}
+		s.logger.WithContext(ctx).WithField("purpose", purpose).WithError(err).Error("failed to consume user token")
+		return "", err
+	}
+
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"user_id": userID,
+		"purpose": purpose,
+	}).Info("user token consumed")
+	return userID, nil
+}
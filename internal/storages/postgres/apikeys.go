@@ -0,0 +1,141 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// CreateAPIKey сохраняет хэш ключа. ttl, равный нулю, означает бессрочный ключ;
+// срок действия считается по часам базы.
+func (s *Storage) CreateAPIKey(ctx context.Context, key storages.APIKey, keyHash string, ttl time.Duration) (storages.APIKey, error) {
+	var expiresIn sql.NullFloat64
+	if ttl > 0 {
+		expiresIn = sql.NullFloat64{Float64: ttl.Seconds(), Valid: true}
+	}
+
+	var expiresAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+        INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, NOW() + make_interval(secs => $6), NOW())
+        RETURNING id, expires_at, created_at`,
+		key.UserID, key.Name, key.Prefix, keyHash, pq.Array(key.Scopes), expiresIn).Scan(&key.ID, &expiresAt, &key.CreatedAt)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", key.UserID).WithError(err).Error("failed to create api key")
+		return storages.APIKey{}, err
+	}
+	key.ExpiresAt = nullTimePtr(expiresAt)
+
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"user_id":    key.UserID,
+		"api_key_id": key.ID,
+	}).Info("api key created in database")
+	return key, nil
+}
+
+func (s *Storage) ListAPIKeys(ctx context.Context, userID string) ([]storages.APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, `
+        SELECT id, user_id, name, prefix, scopes, expires_at, last_used_at, revoked_at, created_at
+        FROM api_keys
+        WHERE user_id = $1
+        ORDER BY id`,
+		userID)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to query api keys")
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []storages.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to scan api key")
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to iterate api keys")
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (s *Storage) RevokeAPIKey(ctx context.Context, userID string, keyID int) error {
+	res, err := s.db.ExecContext(ctx, `
+        UPDATE api_keys
+        SET revoked_at = NOW()
+        WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		keyID, userID)
+	if err != nil {
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"user_id":    userID,
+			"api_key_id": keyID,
+		}).WithError(err).Error("failed to revoke api key")
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return storages.ErrAPIKeyNotFound
+	}
+
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"user_id":    userID,
+		"api_key_id": keyID,
+	}).Info("api key revoked in database")
+	return nil
+}
+
+// AuthenticateAPIKey находит действующий ключ по хэшу и сразу отмечает
+// время использования.
+func (s *Storage) AuthenticateAPIKey(ctx context.Context, keyHash string) (storages.APIKey, error) {
+	row := s.db.QueryRowContext(ctx, `
+        UPDATE api_keys
+        SET last_used_at = NOW()
+        WHERE key_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+        RETURNING id, user_id, name, prefix, scopes, expires_at, last_used_at, revoked_at, created_at`,
+		keyHash)
+
+	key, err := scanAPIKey(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return storages.APIKey{}, storages.ErrAPIKeyInvalid
+		}
+		s.logger.WithContext(ctx).WithError(err).Error("failed to authenticate api key")
+		return storages.APIKey{}, err
+	}
+
+	return key, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row rowScanner) (storages.APIKey, error) {
+	var key storages.APIKey
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, pq.Array(&key.Scopes),
+		&expiresAt, &lastUsedAt, &revokedAt, &key.CreatedAt)
+	if err != nil {
+		return storages.APIKey{}, err
+	}
+
+	key.ExpiresAt = nullTimePtr(expiresAt)
+	key.LastUsedAt = nullTimePtr(lastUsedAt)
+	key.RevokedAt = nullTimePtr(revokedAt)
+	return key, nil
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,274 @@
+package postgres
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+)
+
+// Ключ advisory-блокировки, сериализующей запись в одну цепочку журнала:
+// хэш каждой записи зависит от предыдущей записи цепочки.
+const auditLockKey = 7300533
+
+// AppendAuditEvent добавляет запись в журнал. У каждого пользователя
+// (subject_user_id) своя цепочка HMAC-SHA256, события без пользователя
+// образуют цепочку 0: запись в журнал не сериализует операции разных
+// пользователей. Изменение или удаление любой записи обнаружит
+// VerifyAuditChain, а без ключа из конфигурации цепочку не пересчитать.
+// UPDATE и DELETE для таблицы запрещены триггером.
+func (s *Storage) AppendAuditEvent(ctx context.Context, event storages.AuditEvent) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to begin transaction for audit event")
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.appendAuditEvent(ctx, tx, event); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to commit audit event transaction")
+		return err
+	}
+	return nil
+}
+
+// auditOperation записывает событие об операции с деньгами в транзакции
+// операции: запись в журнале есть тогда и только тогда, когда есть операция.
+// Актор берётся из контекста запроса.
+func (s *Storage) auditOperation(ctx context.Context, tx *sql.Tx, eventType, userID string, metadata map[string]interface{}) error {
+	actor := storages.AuditActorFrom(ctx)
+	return s.appendAuditEvent(ctx, tx, storages.AuditEvent{
+		EventType:     eventType,
+		ActorUserID:   actor.UserID,
+		ActorAPIKeyID: actor.APIKeyID,
+		SubjectUserID: userID,
+		IP:            actor.IP,
+		UserAgent:     actor.UserAgent,
+		Metadata:      metadata,
+	})
+}
+
+// appendAuditEvent добавляет запись в транзакции tx. Блокировка цепочки
+// держится до конца транзакции, поэтому вызывать его стоит последним.
+func (s *Storage) appendAuditEvent(ctx context.Context, tx *sql.Tx, event storages.AuditEvent) error {
+	metadata, err := json.Marshal(event.Metadata)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("event_type", event.EventType).WithError(err).Error("failed to encode audit metadata")
+		return err
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+	event.OccurredAt = event.OccurredAt.UTC().Truncate(time.Microsecond)
+
+	chainKey, err := auditChainKey(event.SubjectUserID)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("event_type", event.EventType).WithError(err).Error("invalid audit subject")
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1, $2)`, auditLockKey, chainKey); err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to lock audit log")
+		return err
+	}
+
+	var prevHash string
+	err = tx.QueryRowContext(ctx, `
+        SELECT hash FROM audit_log
+        WHERE chain_key = $1
+        ORDER BY id DESC
+        LIMIT 1`,
+		chainKey).Scan(&prevHash)
+	if err != nil && err != sql.ErrNoRows {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to get last audit hash")
+		return err
+	}
+
+	hash := auditHash(s.auditKey, prevHash, event, string(metadata))
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO audit_log (occurred_at, event_type, actor_user_id, actor_api_key_id, subject_user_id, ip, user_agent, metadata, chain_key, prev_hash, hash)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		event.OccurredAt, event.EventType, nullString(event.ActorUserID), nullInt(event.ActorAPIKeyID),
+		nullString(event.SubjectUserID), event.IP, event.UserAgent, string(metadata), chainKey, prevHash, hash)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("event_type", event.EventType).WithError(err).Error("failed to append audit event")
+		return err
+	}
+	return nil
+}
+
+func (s *Storage) ListAuditEvents(ctx context.Context, filter storages.AuditFilter) ([]storages.AuditEvent, error) {
+	conditions := []string{"TRUE"}
+	args := []interface{}{}
+	if filter.SubjectUserID != "" {
+		args = append(args, filter.SubjectUserID)
+		conditions = append(conditions, fmt.Sprintf("subject_user_id = $%d", len(args)))
+	}
+	if filter.EventType != "" {
+		args = append(args, filter.EventType)
+		conditions = append(conditions, fmt.Sprintf("event_type = $%d", len(args)))
+	}
+	if filter.BeforeID > 0 {
+		args = append(args, filter.BeforeID)
+		conditions = append(conditions, fmt.Sprintf("id < $%d", len(args)))
+	}
+	args = append(args, filter.Limit)
+
+	rows, err := s.db.QueryContext(ctx, `
+        SELECT id, occurred_at, event_type, actor_user_id, actor_api_key_id, subject_user_id, ip, user_agent, metadata
+        FROM audit_log
+        WHERE `+strings.Join(conditions, " AND ")+`
+        ORDER BY id DESC
+        LIMIT $`+strconv.Itoa(len(args)),
+		args...)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to query audit log")
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []storages.AuditEvent{}
+	for rows.Next() {
+		event, metadata, err := scanAuditEvent(rows)
+		if err != nil {
+			s.logger.WithContext(ctx).WithError(err).Error("failed to scan audit event")
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(metadata), &event.Metadata); err != nil {
+			s.logger.WithContext(ctx).WithField("audit_id", event.ID).WithError(err).Error("failed to decode audit metadata")
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to iterate audit log")
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// VerifyAuditChain пересчитывает цепочки хэшей и возвращает число
+// проверенных записей либо ErrAuditChainBroken. Записи, сделанные до
+// появления цепочек по пользователям (chain_key IS NULL), образуют одну
+// цепочку SHA-256 без ключа и должны идти раньше остальных.
+func (s *Storage) VerifyAuditChain(ctx context.Context) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+        SELECT id, occurred_at, event_type, actor_user_id, actor_api_key_id, subject_user_id, ip, user_agent, metadata, chain_key, prev_hash, hash
+        FROM audit_log
+        ORDER BY id`)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to query audit log for verification")
+		return 0, err
+	}
+	defer rows.Close()
+
+	checked := 0
+	legacyPrev := ""
+	heads := make(map[int64]string)
+	for rows.Next() {
+		var event storages.AuditEvent
+		var metadata, prevHash, hash string
+		var actorUserID, subjectUserID sql.NullString
+		var actorAPIKeyID, chainKey sql.NullInt64
+		err := rows.Scan(&event.ID, &event.OccurredAt, &event.EventType, &actorUserID, &actorAPIKeyID,
+			&subjectUserID, &event.IP, &event.UserAgent, &metadata, &chainKey, &prevHash, &hash)
+		if err != nil {
+			s.logger.WithContext(ctx).WithError(err).Error("failed to scan audit event for verification")
+			return checked, err
+		}
+		event.ActorUserID = actorUserID.String
+		event.ActorAPIKeyID = int(actorAPIKeyID.Int64)
+		event.SubjectUserID = subjectUserID.String
+
+		var ok bool
+		if chainKey.Valid {
+			expected, _ := auditChainKey(event.SubjectUserID)
+			ok = chainKey.Int64 == expected && prevHash == heads[chainKey.Int64] &&
+				auditHash(s.auditKey, prevHash, event, metadata) == hash
+			heads[chainKey.Int64] = hash
+		} else {
+			ok = len(heads) == 0 && prevHash == legacyPrev && auditHash(nil, prevHash, event, metadata) == hash
+			legacyPrev = hash
+		}
+		if !ok {
+			s.logger.WithContext(ctx).WithField("audit_id", event.ID).Error("audit log hash chain broken")
+			return checked, fmt.Errorf("%w at id %d", storages.ErrAuditChainBroken, event.ID)
+		}
+		checked++
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to iterate audit log for verification")
+		return checked, err
+	}
+
+	return checked, nil
+}
+
+func scanAuditEvent(row rowScanner) (storages.AuditEvent, string, error) {
+	var event storages.AuditEvent
+	var metadata string
+	var actorUserID, subjectUserID sql.NullString
+	var actorAPIKeyID sql.NullInt64
+	err := row.Scan(&event.ID, &event.OccurredAt, &event.EventType, &actorUserID, &actorAPIKeyID,
+		&subjectUserID, &event.IP, &event.UserAgent, &metadata)
+	if err != nil {
+		return storages.AuditEvent{}, "", err
+	}
+
+	event.ActorUserID = actorUserID.String
+	event.ActorAPIKeyID = int(actorAPIKeyID.Int64)
+	event.SubjectUserID = subjectUserID.String
+	return event, metadata, nil
+}
+
+// auditChainKey — номер цепочки записи: id пользователя или 0.
+func auditChainKey(subjectUserID string) (int64, error) {
+	if subjectUserID == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(subjectUserID, 10, 32)
+}
+
+// auditHash считает HMAC-SHA256 записи ключом key; без ключа — SHA-256,
+// как у записей до появления ключа.
+func auditHash(key []byte, prevHash string, event storages.AuditEvent, metadata string) string {
+	fields := []string{
+		prevHash,
+		event.OccurredAt.UTC().Format(time.RFC3339Nano),
+		event.EventType,
+		event.ActorUserID,
+		strconv.Itoa(event.ActorAPIKeyID),
+		event.SubjectUserID,
+		event.IP,
+		event.UserAgent,
+		metadata,
+	}
+	data := []byte(strings.Join(fields, "\x1f"))
+	if key == nil {
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+func nullInt(value int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(value), Valid: value != 0}
+}
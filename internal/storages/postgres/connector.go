@@ -1,25 +1,39 @@
 package postgres
 
 import (
-	"database/sql"
 	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq"
 	"github.com/sirupsen/logrus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
-func NewStorage(cfg config.DBConfig) (*Storage, error) {
+// NewStorage подключается к базе. auditKey — ключ HMAC цепочки журнала аудита.
+func NewStorage(cfg config.DBConfig, auditKey string, logger *logrus.Logger) (*Storage, error) {
 	connStr := cfg.ConnectionString()
-	db, err := sql.Open("postgres", connStr)
+	// Каждый запрос к базе становится дочерним спаном трассировки запроса.
+	db, err := otelsql.Open("postgres", connStr,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitConnPrepare:      true,
+			OmitRows:             true,
+		}),
+	)
 	if err != nil {
-		logrus.WithError(err).Error("failed to open database connection")
+		logger.WithError(err).Error("failed to open database connection")
 		return nil, err
 	}
 
 	if err := db.Ping(); err != nil {
-		logrus.WithError(err).Error("failed to ping database")
+		logger.WithError(err).Error("failed to ping database")
 		return nil, err
 	}
 
-	logrus.Info("database connection established")
-	return &Storage{db: db}, nil
+	logger.Info("database connection established")
+	return &Storage{db: db, dsn: connStr, auditKey: []byte(auditKey), logger: logger}, nil
+}
+
+func (s *Storage) Close() error {
+	return s.db.Close()
 }
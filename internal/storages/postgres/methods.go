@@ -1,82 +1,103 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"github.com/Krchnk/gw-currency-wallet/internal/storages"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type Storage struct {
-	db *sql.DB
+	db       *sql.DB
+	dsn      string // для отдельного соединения LISTEN
+	auditKey []byte // ключ HMAC цепочки журнала аудита
+	logger   *logrus.Logger
 }
 
-func (s *Storage) RegisterUser(username, password, email string) error {
+// DB возвращает пул соединений, например для экспорта его статистики.
+func (s *Storage) DB() *sql.DB {
+	return s.db
+}
+
+func (s *Storage) RegisterUser(ctx context.Context, username, passwordHash, email string) error {
 	var exists int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM users WHERE username = $1 OR email = $2", username, email).Scan(&exists)
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE username = $1 OR email = $2", username, email).Scan(&exists)
 	if err != nil {
-		logrus.WithError(err).Error("failed to check user existence")
+		s.logger.WithContext(ctx).WithError(err).Error("failed to check user existence")
 		return err
 	}
 	if exists > 0 {
-		logrus.WithFields(logrus.Fields{
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
 			"username": username,
 			"email":    email,
 		}).Error("username or email already exists")
 		return errors.New("username or email already exists")
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		logrus.WithError(err).Error("failed to hash password")
-		return err
-	}
-
-	_, err = s.db.Exec(`
+	_, err = s.db.ExecContext(ctx, `
         INSERT INTO users (username, password_hash, email, created_at)
         VALUES ($1, $2, $3, NOW())`,
-		username, string(hashedPassword), email)
+		username, passwordHash, email)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
 			"username": username,
 			"email":    email,
 		}).WithError(err).Error("failed to register user")
 		return err
 	}
 
-	logrus.WithField("username", username).Info("user registered in database")
+	s.logger.WithContext(ctx).WithField("username", username).Info("user registered in database")
 	return nil
 }
 
-func (s *Storage) GetUser(username string) (storages.User, error) {
+func (s *Storage) GetUser(ctx context.Context, username string) (storages.User, error) {
 	var user storages.User
-	err := s.db.QueryRow(`
-        SELECT id, username, password_hash, email
+	err := s.db.QueryRowContext(ctx, `
+        SELECT id, username, password_hash, email, email_verified_at IS NOT NULL, token_version, is_admin
         FROM users
         WHERE username = $1`,
-		username).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Email)
+		username).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Email, &user.EmailVerified, &user.TokenVersion, &user.IsAdmin)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			s.logger.WithContext(ctx).WithField("username", username).Error("user not found")
+			return storages.User{}, errors.New("user not found")
+		}
+		s.logger.WithContext(ctx).WithField("username", username).WithError(err).Error("failed to get user")
+		return storages.User{}, err
+	}
+
+	s.logger.WithContext(ctx).WithField("username", username).Info("user retrieved from database")
+	return user, nil
+}
+
+func (s *Storage) GetUserByID(ctx context.Context, userID string) (storages.User, error) {
+	var user storages.User
+	err := s.db.QueryRowContext(ctx, `
+        SELECT id, username, password_hash, email, email_verified_at IS NOT NULL, token_version, is_admin
+        FROM users
+        WHERE id = $1`,
+		userID).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Email, &user.EmailVerified, &user.TokenVersion, &user.IsAdmin)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			logrus.WithField("username", username).Error("user not found")
+			s.logger.WithContext(ctx).WithField("user_id", userID).Error("user not found")
 			return storages.User{}, errors.New("user not found")
 		}
-		logrus.WithField("username", username).WithError(err).Error("failed to get user")
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to get user")
 		return storages.User{}, err
 	}
 
-	logrus.WithField("username", username).Info("user retrieved from database")
 	return user, nil
 }
 
-func (s *Storage) GetBalance(userID string) (map[string]float64, error) {
-	rows, err := s.db.Query(`
+func (s *Storage) GetBalance(ctx context.Context, userID string) (map[string]float64, error) {
+	rows, err := s.db.QueryContext(ctx, `
         SELECT currency, amount
         FROM balances
         WHERE user_id = $1`,
 		userID)
 	if err != nil {
-		logrus.WithField("user_id", userID).WithError(err).Error("failed to query balance")
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to query balance")
 		return nil, err
 	}
 	defer rows.Close()
@@ -86,7 +107,7 @@ func (s *Storage) GetBalance(userID string) (map[string]float64, error) {
 		var currency string
 		var amount float64
 		if err := rows.Scan(&currency, &amount); err != nil {
-			logrus.WithField("user_id", userID).WithError(err).Error("failed to scan balance")
+			s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to scan balance")
 			return nil, err
 		}
 		balance[currency] = amount
@@ -98,29 +119,34 @@ func (s *Storage) GetBalance(userID string) (map[string]float64, error) {
 		}
 	}
 
-	logrus.WithFields(logrus.Fields{
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
 		"user_id": userID,
 		"balance": balance,
 	}).Info("balance retrieved from database")
 	return balance, nil
 }
 
-func (s *Storage) Deposit(userID, currency string, amount float64) error {
-	tx, err := s.db.Begin()
+// Deposit зачисляет amount за вычетом комиссии fee.
+func (s *Storage) Deposit(ctx context.Context, userID, currency string, amount, fee float64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		logrus.WithError(err).Error("failed to begin transaction for deposit")
+		s.logger.WithContext(ctx).WithError(err).Error("failed to begin transaction for deposit")
 		return err
 	}
 	defer tx.Rollback()
 
-	_, err = tx.Exec(`
+	if err := s.lockUser(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
         INSERT INTO balances (user_id, currency, amount)
         VALUES ($1, $2, $3)
         ON CONFLICT (user_id, currency)
         DO UPDATE SET amount = balances.amount + EXCLUDED.amount`,
-		userID, currency, amount)
+		userID, currency, amount-fee)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
 			"user_id":  userID,
 			"currency": currency,
 			"amount":   amount,
@@ -128,29 +154,56 @@ func (s *Storage) Deposit(userID, currency string, amount float64) error {
 		return err
 	}
 
+	recorded, err := s.recordTransaction(ctx, tx, userID, storages.Transaction{
+		Type:     storages.TransactionDeposit,
+		Currency: currency,
+		Amount:   amount,
+		Fee:      fee,
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.recordEvent(ctx, tx, userID, storages.EventDepositCompleted, recorded); err != nil {
+		return err
+	}
+	if err := s.auditOperation(ctx, tx, storages.AuditDeposit, userID, map[string]interface{}{
+		"transaction_id": recorded.ID,
+		"currency":       currency,
+		"amount":         amount,
+		"fee":            fee,
+	}); err != nil {
+		return err
+	}
+
 	if err := tx.Commit(); err != nil {
-		logrus.WithError(err).Error("failed to commit deposit transaction")
+		s.logger.WithContext(ctx).WithError(err).Error("failed to commit deposit transaction")
 		return err
 	}
 
-	logrus.WithFields(logrus.Fields{
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
 		"user_id":  userID,
 		"currency": currency,
 		"amount":   amount,
+		"fee":      fee,
 	}).Info("deposit completed in database")
 	return nil
 }
 
-func (s *Storage) Withdraw(userID, currency string, amount float64) error {
-	tx, err := s.db.Begin()
+// Withdraw списывает amount и комиссию fee сверх него.
+func (s *Storage) Withdraw(ctx context.Context, userID, currency string, amount, fee float64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		logrus.WithError(err).Error("failed to begin transaction for withdraw")
+		s.logger.WithContext(ctx).WithError(err).Error("failed to begin transaction for withdraw")
 		return err
 	}
 	defer tx.Rollback()
 
+	if err := s.lockUser(ctx, tx, userID); err != nil {
+		return err
+	}
+
 	var currentBalance float64
-	err = tx.QueryRow(`
+	err = tx.QueryRowContext(ctx, `
         SELECT amount
         FROM balances
         WHERE user_id = $1 AND currency = $2
@@ -160,7 +213,7 @@ func (s *Storage) Withdraw(userID, currency string, amount float64) error {
 		if err == sql.ErrNoRows {
 			currentBalance = 0.0
 		} else {
-			logrus.WithFields(logrus.Fields{
+			s.logger.WithContext(ctx).WithFields(logrus.Fields{
 				"user_id":  userID,
 				"currency": currency,
 			}).WithError(err).Error("failed to get current balance for withdraw")
@@ -168,24 +221,25 @@ func (s *Storage) Withdraw(userID, currency string, amount float64) error {
 		}
 	}
 
-	if currentBalance < amount {
-		logrus.WithFields(logrus.Fields{
+	if currentBalance < amount+fee {
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
 			"user_id":         userID,
 			"currency":        currency,
 			"current_balance": currentBalance,
 			"amount":          amount,
+			"fee":             fee,
 		}).Error("insufficient funds for withdraw")
-		return errors.New("insufficient funds")
+		return storages.ErrInsufficientFunds
 	}
 
-	_, err = tx.Exec(`
+	_, err = tx.ExecContext(ctx, `
         INSERT INTO balances (user_id, currency, amount)
         VALUES ($1, $2, $3)
         ON CONFLICT (user_id, currency)
         DO UPDATE SET amount = balances.amount - EXCLUDED.amount`,
-		userID, currency, amount)
+		userID, currency, amount+fee)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
 			"user_id":  userID,
 			"currency": currency,
 			"amount":   amount,
@@ -193,29 +247,57 @@ func (s *Storage) Withdraw(userID, currency string, amount float64) error {
 		return err
 	}
 
+	recorded, err := s.recordTransaction(ctx, tx, userID, storages.Transaction{
+		Type:     storages.TransactionWithdraw,
+		Currency: currency,
+		Amount:   amount,
+		Fee:      fee,
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.recordEvent(ctx, tx, userID, storages.EventWithdrawalCompleted, recorded); err != nil {
+		return err
+	}
+	if err := s.auditOperation(ctx, tx, storages.AuditWithdraw, userID, map[string]interface{}{
+		"transaction_id": recorded.ID,
+		"currency":       currency,
+		"amount":         amount,
+		"fee":            fee,
+	}); err != nil {
+		return err
+	}
+
 	if err := tx.Commit(); err != nil {
-		logrus.WithError(err).Error("failed to commit withdraw transaction")
+		s.logger.WithContext(ctx).WithError(err).Error("failed to commit withdraw transaction")
 		return err
 	}
 
-	logrus.WithFields(logrus.Fields{
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
 		"user_id":  userID,
 		"currency": currency,
 		"amount":   amount,
+		"fee":      fee,
 	}).Info("withdraw completed in database")
 	return nil
 }
 
-func (s *Storage) Exchange(userID, fromCurrency, toCurrency string, amount, rate float64) error {
-	tx, err := s.db.Begin()
+// Exchange списывает amount и зачисляет по курсу rate сумму за вычетом
+// комиссии fee.
+func (s *Storage) Exchange(ctx context.Context, userID, fromCurrency, toCurrency string, amount, fee, rate float64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		logrus.WithError(err).Error("failed to begin transaction for exchange")
+		s.logger.WithContext(ctx).WithError(err).Error("failed to begin transaction for exchange")
 		return err
 	}
 	defer tx.Rollback()
 
+	if err := s.lockUser(ctx, tx, userID); err != nil {
+		return err
+	}
+
 	var fromBalance float64
-	err = tx.QueryRow(`
+	err = tx.QueryRowContext(ctx, `
         SELECT amount
         FROM balances
         WHERE user_id = $1 AND currency = $2
@@ -225,7 +307,7 @@ func (s *Storage) Exchange(userID, fromCurrency, toCurrency string, amount, rate
 		if err == sql.ErrNoRows {
 			fromBalance = 0.0
 		} else {
-			logrus.WithFields(logrus.Fields{
+			s.logger.WithContext(ctx).WithFields(logrus.Fields{
 				"user_id":       userID,
 				"from_currency": fromCurrency,
 			}).WithError(err).Error("failed to get from balance for exchange")
@@ -234,23 +316,23 @@ func (s *Storage) Exchange(userID, fromCurrency, toCurrency string, amount, rate
 	}
 
 	if fromBalance < amount {
-		logrus.WithFields(logrus.Fields{
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
 			"user_id":       userID,
 			"from_currency": fromCurrency,
 			"from_balance":  fromBalance,
 			"amount":        amount,
 		}).Error("insufficient funds for exchange")
-		return errors.New("insufficient funds")
+		return storages.ErrInsufficientFunds
 	}
 
-	_, err = tx.Exec(`
+	_, err = tx.ExecContext(ctx, `
         INSERT INTO balances (user_id, currency, amount)
         VALUES ($1, $2, $3)
         ON CONFLICT (user_id, currency)
         DO UPDATE SET amount = balances.amount - EXCLUDED.amount`,
 		userID, fromCurrency, amount)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
 			"user_id":       userID,
 			"from_currency": fromCurrency,
 			"amount":        amount,
@@ -258,15 +340,15 @@ func (s *Storage) Exchange(userID, fromCurrency, toCurrency string, amount, rate
 		return err
 	}
 
-	toAmount := amount * rate
-	_, err = tx.Exec(`
+	toAmount := (amount - fee) * rate
+	_, err = tx.ExecContext(ctx, `
         INSERT INTO balances (user_id, currency, amount)
         VALUES ($1, $2, $3)
         ON CONFLICT (user_id, currency)
         DO UPDATE SET amount = balances.amount + EXCLUDED.amount`,
 		userID, toCurrency, toAmount)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
 			"user_id":     userID,
 			"to_currency": toCurrency,
 			"amount":      toAmount,
@@ -274,30 +356,58 @@ func (s *Storage) Exchange(userID, fromCurrency, toCurrency string, amount, rate
 		return err
 	}
 
+	recorded, err := s.recordTransaction(ctx, tx, userID, storages.Transaction{
+		Type:       storages.TransactionExchange,
+		Currency:   fromCurrency,
+		Amount:     amount,
+		Fee:        fee,
+		ToCurrency: toCurrency,
+		ToAmount:   toAmount,
+		Rate:       rate,
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.recordEvent(ctx, tx, userID, storages.EventExchangeCompleted, recorded); err != nil {
+		return err
+	}
+	if err := s.auditOperation(ctx, tx, storages.AuditExchange, userID, map[string]interface{}{
+		"transaction_id": recorded.ID,
+		"from_currency":  fromCurrency,
+		"to_currency":    toCurrency,
+		"amount":         amount,
+		"fee":            fee,
+		"rate":           rate,
+		"to_amount":      toAmount,
+	}); err != nil {
+		return err
+	}
+
 	if err := tx.Commit(); err != nil {
-		logrus.WithError(err).Error("failed to commit exchange transaction")
+		s.logger.WithContext(ctx).WithError(err).Error("failed to commit exchange transaction")
 		return err
 	}
 
-	logrus.WithFields(logrus.Fields{
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
 		"user_id":       userID,
 		"from_currency": fromCurrency,
 		"to_currency":   toCurrency,
 		"amount":        amount,
+		"fee":           fee,
 		"rate":          rate,
 		"to_amount":     toAmount,
 	}).Info("exchange completed in database")
 	return nil
 }
 
-func (s *Storage) GetExchangeRates() (map[string]float64, error) {
-	rows, err := s.db.Query(`
+func (s *Storage) GetExchangeRates(ctx context.Context) (map[string]float64, error) {
+	rows, err := s.db.QueryContext(ctx, `
         SELECT to_currency, rate
         FROM exchange_rates
         WHERE from_currency = $1`,
 		"USD")
 	if err != nil {
-		logrus.WithError(err).Error("failed to query exchange rates")
+		s.logger.WithContext(ctx).WithError(err).Error("failed to query exchange rates")
 		return nil, err
 	}
 	defer rows.Close()
@@ -308,39 +418,39 @@ func (s *Storage) GetExchangeRates() (map[string]float64, error) {
 		var currency string
 		var rate float64
 		if err := rows.Scan(&currency, &rate); err != nil {
-			logrus.WithError(err).Error("failed to scan exchange rates")
+			s.logger.WithContext(ctx).WithError(err).Error("failed to scan exchange rates")
 			return nil, err
 		}
 		rates[currency] = rate
 	}
 
-	logrus.WithField("rates", rates).Info("exchange rates retrieved from database")
+	s.logger.WithContext(ctx).WithField("rates", rates).Info("exchange rates retrieved from database")
 	return rates, nil
 }
 
-func (s *Storage) GetExchangeRate(from, to string) (float64, error) {
+func (s *Storage) GetExchangeRate(ctx context.Context, from, to string) (float64, error) {
 	var rate float64
-	err := s.db.QueryRow(`
+	err := s.db.QueryRowContext(ctx, `
         SELECT rate
         FROM exchange_rates
         WHERE from_currency = $1 AND to_currency = $2`,
 		from, to).Scan(&rate)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			logrus.WithFields(logrus.Fields{
+			s.logger.WithContext(ctx).WithFields(logrus.Fields{
 				"from": from,
 				"to":   to,
 			}).Error("exchange rate not found")
 			return 0, errors.New("exchange rate not found")
 		}
-		logrus.WithFields(logrus.Fields{
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
 			"from": from,
 			"to":   to,
 		}).WithError(err).Error("failed to get exchange rate")
 		return 0, err
 	}
 
-	logrus.WithFields(logrus.Fields{
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
 		"from": from,
 		"to":   to,
 		"rate": rate,
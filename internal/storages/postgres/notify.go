@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// eventsChannel — канал NOTIFY, в который пишутся события кошелька.
+const eventsChannel = "wallet_events"
+
+// listenerPingInterval — как часто проверять соединение LISTEN, если
+// уведомлений нет: без трафика обрыв соединения может остаться незамеченным.
+const listenerPingInterval = 90 * time.Second
+
+// notifyEvent отправляет событие в eventsChannel. Тело события — одна
+// операция, оно далеко от предела NOTIFY в 8000 байт.
+func (s *Storage) notifyEvent(ctx context.Context, tx *sql.Tx, payload []byte) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`, eventsChannel, string(payload))
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to notify wallet event")
+	}
+	return err
+}
+
+// ListenEvents вызывает handle для каждого события кошелька, записанного
+// любым экземпляром сервиса, до отмены ctx. Соединение LISTEN отдельное от
+// пула и переподключается само; уведомления за время обрыва теряются,
+// поэтому после переподключения вызывается resync.
+func (s *Storage) ListenEvents(ctx context.Context, handle func(payload []byte), resync func()) error {
+	listener := pq.NewListener(s.dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			s.logger.WithError(err).Warn("event listener disconnected")
+		case pq.ListenerEventConnectionAttemptFailed:
+			s.logger.WithError(err).Warn("event listener failed to reconnect")
+		case pq.ListenerEventReconnected:
+			s.logger.Info("event listener reconnected")
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(eventsChannel); err != nil {
+		s.logger.WithError(err).Error("failed to listen for wallet events")
+		return err
+	}
+
+	ticker := time.NewTicker(listenerPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			// nil приходит после переподключения
+			if n == nil {
+				resync()
+				continue
+			}
+			handle([]byte(n.Extra))
+		case <-ticker.C:
+			go listener.Ping()
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// outboxLockID — ключ advisory-lock, которым экземпляры сервиса решают,
+// кто сейчас публикует outbox.
+const outboxLockID = 7_310_001
+
+// userLockSpace — первый ключ двухаргументного advisory-lock денежных
+// операций пользователя. Такие ключи не пересекаются с outboxLockID.
+const userLockSpace = 1
+
+// lockUser сериализует денежные операции пользователя до конца транзакции.
+// Без этого операции в разных валютах могли получить id в outbox в одном
+// порядке, а зафиксироваться в другом, и relay опубликовал бы более позднюю
+// раньше, пока ранняя ещё не видна.
+func (s *Storage) lockUser(ctx context.Context, tx *sql.Tx, userID string) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1, hashtext($2))`, userLockSpace, userID)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to lock user operations")
+	}
+	return err
+}
+
+// recordEvent записывает событие операции в outbox и в очередь вебхуков
+// и уведомляет о нём подписчиков ListenEvents. Вызывается в транзакции
+// операции, так что событие не теряется и не публикуется для откатившейся
+// операции: NOTIFY тоже доставляется только после COMMIT.
+func (s *Storage) recordEvent(ctx context.Context, tx *sql.Tx, userID, eventType string, t storages.Transaction) error {
+	event := storages.Event{
+		ID:        fmt.Sprintf("evt_%d", t.ID),
+		Type:      eventType,
+		CreatedAt: t.CreatedAt,
+		UserID:    userID,
+		Data:      t,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO outbox (event_id, aggregate_id, event_type, payload, created_at)
+        VALUES ($1, $2, $3, $4, NOW())`,
+		event.ID, userID, eventType, string(payload))
+	if err != nil {
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"user_id":    userID,
+			"event_type": eventType,
+		}).WithError(err).Error("failed to write outbox event")
+		return err
+	}
+
+	if err := s.enqueueWebhookEvent(ctx, tx, event, payload); err != nil {
+		return err
+	}
+	return s.notifyEvent(ctx, tx, payload)
+}
+
+// LockOutbox берёт право публиковать outbox: сессионный advisory-lock на
+// отдельном соединении из пула. Транзакция при этом не открыта, так что
+// долгие обращения к брокеру не держат ни снимок, ни блокировки строк.
+// Если право у другого экземпляра — ErrOutboxLocked.
+func (s *Storage) LockOutbox(ctx context.Context) (storages.OutboxLock, error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to get connection for outbox lock")
+		return nil, err
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, outboxLockID).Scan(&locked); err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to take outbox lock")
+		discardConn(conn)
+		return nil, err
+	}
+	if !locked {
+		conn.Close()
+		return nil, storages.ErrOutboxLocked
+	}
+	return &outboxLock{conn: conn, logger: s.logger}, nil
+}
+
+type outboxLock struct {
+	conn   *sql.Conn
+	logger *logrus.Logger
+}
+
+func (l *outboxLock) Pending(ctx context.Context, limit int) ([]storages.OutboxMessage, error) {
+	rows, err := l.conn.QueryContext(ctx, `
+        SELECT id, event_id, aggregate_id, event_type, payload, created_at, attempts
+        FROM outbox o
+        WHERE published_at IS NULL AND dead_at IS NULL
+          AND NOT EXISTS (
+            SELECT 1 FROM outbox w
+            WHERE w.aggregate_id = o.aggregate_id AND w.id <= o.id
+              AND w.published_at IS NULL AND w.dead_at IS NULL
+              AND w.next_attempt_at > NOW())
+        ORDER BY id
+        LIMIT $1`,
+		limit)
+	if err != nil {
+		l.logger.WithContext(ctx).WithError(err).Error("failed to query outbox")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []storages.OutboxMessage
+	for rows.Next() {
+		var m storages.OutboxMessage
+		var payload []byte
+		if err := rows.Scan(&m.ID, &m.EventID, &m.Key, &m.Type, &payload, &m.CreatedAt, &m.Attempts); err != nil {
+			l.logger.WithContext(ctx).WithError(err).Error("failed to scan outbox event")
+			return nil, err
+		}
+		m.Payload = payload
+		messages = append(messages, m)
+	}
+	if err := rows.Err(); err != nil {
+		l.logger.WithContext(ctx).WithError(err).Error("failed to iterate outbox")
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (l *outboxLock) MarkPublished(ctx context.Context, ids []int64) error {
+	_, err := l.conn.ExecContext(ctx, `
+        UPDATE outbox
+        SET published_at = NOW(), last_error = NULL
+        WHERE id = ANY($1)`,
+		pq.Array(ids))
+	if err != nil {
+		l.logger.WithContext(ctx).WithError(err).Error("failed to mark outbox events published")
+	}
+	return err
+}
+
+func (l *outboxLock) MarkFailed(ctx context.Context, id int64, reason string, retryAfter time.Duration) error {
+	_, err := l.conn.ExecContext(ctx, `
+        UPDATE outbox
+        SET attempts = attempts + 1, last_error = $2, next_attempt_at = NOW() + make_interval(secs => $3)
+        WHERE id = $1`,
+		id, reason, retryAfter.Seconds())
+	if err != nil {
+		l.logger.WithContext(ctx).WithField("outbox_id", id).WithError(err).Error("failed to record outbox error")
+	}
+	return err
+}
+
+func (l *outboxLock) MarkDead(ctx context.Context, id int64, reason string) error {
+	_, err := l.conn.ExecContext(ctx, `
+        UPDATE outbox
+        SET attempts = attempts + 1, last_error = $2, dead_at = NOW()
+        WHERE id = $1`,
+		id, reason)
+	if err != nil {
+		l.logger.WithContext(ctx).WithField("outbox_id", id).WithError(err).Error("failed to move outbox event to dead letter")
+	}
+	return err
+}
+
+// Release закрывает соединение, а не возвращает его в пул: сессионный lock
+// снимается вместе с сессией, даже если pg_advisory_unlock не дошёл бы до
+// базы.
+func (l *outboxLock) Release() {
+	discardConn(l.conn)
+}
+
+// discardConn закрывает соединение пула насовсем.
+func discardConn(conn *sql.Conn) {
+	_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+	conn.Close()
+}
+
+// DeletePublishedOutbox удаляет события, опубликованные раньше before.
+func (s *Storage) DeletePublishedOutbox(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `
+        DELETE FROM outbox
+        WHERE published_at IS NOT NULL AND published_at < $1`,
+		before)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to delete published outbox events")
+		return 0, err
+	}
+	deleted, _ := res.RowsAffected()
+	return deleted, nil
+}
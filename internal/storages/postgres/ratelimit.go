@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"github.com/Krchnk/gw-currency-wallet/internal/ratelimit"
+)
+
+// RateLimitStore хранит token bucket'ы в Postgres, чтобы все реплики
+// сервиса делили один лимит. Время берётся из базы, поэтому расхождение
+// часов между репликами не влияет на пополнение корзин.
+type RateLimitStore struct {
+	storage *Storage
+}
+
+func NewRateLimitStore(storage *Storage) *RateLimitStore {
+	return &RateLimitStore{storage: storage}
+}
+
+func (r *RateLimitStore) Take(ctx context.Context, key string, policy config.RateLimitPolicy) (ratelimit.Result, error) {
+	tx, err := r.storage.db.BeginTx(ctx, nil)
+	if err != nil {
+		r.storage.logger.WithContext(ctx).WithError(err).Error("failed to begin transaction for rate limit")
+		return ratelimit.Result{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+        INSERT INTO rate_limit_buckets (key, tokens, updated_at)
+        VALUES ($1, $2, NOW())
+        ON CONFLICT (key) DO NOTHING`,
+		key, float64(policy.Burst))
+	if err != nil {
+		r.storage.logger.WithContext(ctx).WithField("key", key).WithError(err).Error("failed to init rate limit bucket")
+		return ratelimit.Result{}, err
+	}
+
+	var tokens, elapsed float64
+	err = tx.QueryRowContext(ctx, `
+        SELECT tokens, EXTRACT(EPOCH FROM (NOW() - updated_at))
+        FROM rate_limit_buckets
+        WHERE key = $1
+        FOR UPDATE`,
+		key).Scan(&tokens, &elapsed)
+	if err != nil {
+		r.storage.logger.WithContext(ctx).WithField("key", key).WithError(err).Error("failed to get rate limit bucket")
+		return ratelimit.Result{}, err
+	}
+
+	tokens, res := ratelimit.Take(tokens, elapsed, policy)
+
+	_, err = tx.ExecContext(ctx, `
+        UPDATE rate_limit_buckets
+        SET tokens = $2, updated_at = NOW(), reset_at = NOW() + make_interval(secs => $3)
+        WHERE key = $1`,
+		key, tokens, res.Reset.Seconds())
+	if err != nil {
+		r.storage.logger.WithContext(ctx).WithField("key", key).WithError(err).Error("failed to update rate limit bucket")
+		return ratelimit.Result{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		r.storage.logger.WithContext(ctx).WithError(err).Error("failed to commit rate limit transaction")
+		return ratelimit.Result{}, err
+	}
+
+	return res, nil
+}
+
+// DeleteExpired удаляет корзины, которые уже полностью восстановились:
+// полная корзина ничем не отличается от отсутствующей.
+func (r *RateLimitStore) DeleteExpired(ctx context.Context) (int64, error) {
+	res, err := r.storage.db.ExecContext(ctx, `DELETE FROM rate_limit_buckets WHERE reset_at < NOW()`)
+	if err != nil {
+		r.storage.logger.WithContext(ctx).WithError(err).Error("failed to delete expired rate limit buckets")
+		return 0, err
+	}
+	return res.RowsAffected()
+}
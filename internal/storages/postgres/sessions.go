@@ -0,0 +1,141 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+)
+
+// CreateSession сохраняет сессию; срок действия считается по часам базы.
+func (s *Storage) CreateSession(ctx context.Context, session storages.Session, ttl time.Duration) (storages.Session, error) {
+	err := s.db.QueryRowContext(ctx, `
+        INSERT INTO sessions (id, user_id, device, ip, user_agent, created_at, last_seen_at, expires_at)
+        VALUES ($1, $2, $3, $4, $5, NOW(), NOW(), NOW() + make_interval(secs => $6))
+        RETURNING created_at, last_seen_at, expires_at`,
+		session.ID, session.UserID, session.Device, session.IP, session.UserAgent, ttl.Seconds()).
+		Scan(&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", session.UserID).WithError(err).Error("failed to create session")
+		return storages.Session{}, err
+	}
+
+	s.logger.WithContext(ctx).WithField("user_id", session.UserID).Info("session created in database")
+	return session, nil
+}
+
+// ValidateSession проверяет, что сессия принадлежит пользователю, не отозвана,
+// не истекла и выдана для текущей token_version. Заодно обновляет last_seen_at,
+// но не чаще раза в минуту, чтобы не писать в базу на каждый запрос.
+func (s *Storage) ValidateSession(ctx context.Context, sessionID, userID string, tokenVersion int) error {
+	res, err := s.db.ExecContext(ctx, `
+        UPDATE sessions
+        SET last_seen_at = CASE
+            WHEN sessions.last_seen_at < NOW() - INTERVAL '1 minute' THEN NOW()
+            ELSE sessions.last_seen_at
+        END
+        FROM users
+        WHERE sessions.id = $1 AND sessions.user_id = $2
+          AND users.id = sessions.user_id AND users.token_version = $3
+          AND sessions.revoked_at IS NULL AND sessions.expires_at > NOW()`,
+		sessionID, userID, tokenVersion)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to validate session")
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return storages.ErrSessionInvalid
+	}
+	return nil
+}
+
+func (s *Storage) ListSessions(ctx context.Context, userID string) ([]storages.Session, error) {
+	rows, err := s.db.QueryContext(ctx, `
+        SELECT id, user_id, device, ip, user_agent, created_at, last_seen_at, expires_at
+        FROM sessions
+        WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+        ORDER BY last_seen_at DESC`,
+		userID)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to query sessions")
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []storages.Session{}
+	for rows.Next() {
+		var session storages.Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.Device, &session.IP, &session.UserAgent,
+			&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt)
+		if err != nil {
+			s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to scan session")
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to iterate sessions")
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// RefreshSession продлевает действующую сессию на ttl от текущего момента.
+func (s *Storage) RefreshSession(ctx context.Context, userID, sessionID string, ttl time.Duration) (storages.Session, error) {
+	var session storages.Session
+	err := s.db.QueryRowContext(ctx, `
+        UPDATE sessions
+        SET expires_at = NOW() + make_interval(secs => $3), last_seen_at = NOW()
+        WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > NOW()
+        RETURNING id, user_id, device, ip, user_agent, created_at, last_seen_at, expires_at`,
+		sessionID, userID, ttl.Seconds()).
+		Scan(&session.ID, &session.UserID, &session.Device, &session.IP, &session.UserAgent,
+			&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return storages.Session{}, storages.ErrSessionInvalid
+	}
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to refresh session")
+		return storages.Session{}, err
+	}
+
+	s.logger.WithContext(ctx).WithField("user_id", userID).Info("session refreshed in database")
+	return session, nil
+}
+
+func (s *Storage) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	res, err := s.db.ExecContext(ctx, `
+        UPDATE sessions
+        SET revoked_at = NOW()
+        WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		sessionID, userID)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to revoke session")
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return storages.ErrSessionNotFound
+	}
+
+	s.logger.WithContext(ctx).WithField("user_id", userID).Info("session revoked in database")
+	return nil
+}
+
+func (s *Storage) RevokeOtherSessions(ctx context.Context, userID, keepSessionID string) error {
+	_, err := s.db.ExecContext(ctx, `
+        UPDATE sessions
+        SET revoked_at = NOW()
+        WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL`,
+		userID, keepSessionID)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to revoke other sessions")
+		return err
+	}
+
+	s.logger.WithContext(ctx).WithField("user_id", userID).Info("other sessions revoked in database")
+	return nil
+}
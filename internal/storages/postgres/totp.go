@@ -0,0 +1,224 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+)
+
+func (s *Storage) SaveTOTPSecret(ctx context.Context, userID, encryptedSecret string) error {
+	res, err := s.db.ExecContext(ctx, `
+        INSERT INTO user_totp (user_id, secret_encrypted, created_at)
+        VALUES ($1, $2, NOW())
+        ON CONFLICT (user_id)
+        DO UPDATE SET secret_encrypted = EXCLUDED.secret_encrypted, created_at = NOW(), last_used_step = 0
+        WHERE user_totp.confirmed_at IS NULL`,
+		userID, encryptedSecret)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to save totp secret")
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		s.logger.WithContext(ctx).WithField("user_id", userID).Error("totp already enabled")
+		return storages.ErrTOTPAlreadyEnabled
+	}
+
+	s.logger.WithContext(ctx).WithField("user_id", userID).Info("totp secret saved in database")
+	return nil
+}
+
+func (s *Storage) GetTOTP(ctx context.Context, userID string) (storages.TOTP, error) {
+	totp := storages.TOTP{UserID: userID}
+	var confirmedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+        SELECT secret_encrypted, confirmed_at, last_used_step
+        FROM user_totp
+        WHERE user_id = $1`,
+		userID).Scan(&totp.EncryptedSecret, &confirmedAt, &totp.LastUsedStep)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return storages.TOTP{}, storages.ErrTOTPNotEnrolled
+		}
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to get totp")
+		return storages.TOTP{}, err
+	}
+
+	totp.Confirmed = confirmedAt.Valid
+	return totp, nil
+}
+
+func (s *Storage) ConfirmTOTP(ctx context.Context, userID string, step int64, recoveryCodeHashes []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to begin transaction for totp confirmation")
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+        UPDATE user_totp
+        SET confirmed_at = NOW(), last_used_step = $2
+        WHERE user_id = $1 AND confirmed_at IS NULL`,
+		userID, step)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to confirm totp")
+		return err
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		s.logger.WithContext(ctx).WithField("user_id", userID).Error("no pending totp enrollment")
+		return storages.ErrTOTPNotEnrolled
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to delete old recovery codes")
+		return err
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		_, err := tx.ExecContext(ctx, `
+            INSERT INTO user_recovery_codes (user_id, code_hash, created_at)
+            VALUES ($1, $2, NOW())`,
+			userID, hash)
+		if err != nil {
+			s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to save recovery code")
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to commit totp confirmation transaction")
+		return err
+	}
+
+	s.logger.WithContext(ctx).WithField("user_id", userID).Info("totp confirmed in database")
+	return nil
+}
+
+// UseTOTPStep запоминает шаг последнего принятого кода. Код того же или
+// более раннего шага после этого не принимается.
+func (s *Storage) UseTOTPStep(ctx context.Context, userID string, step int64) error {
+	res, err := s.db.ExecContext(ctx, `
+        UPDATE user_totp
+        SET last_used_step = $2
+        WHERE user_id = $1 AND last_used_step < $2`,
+		userID, step)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to update totp step")
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		s.logger.WithContext(ctx).WithField("user_id", userID).Error("totp code already used")
+		return storages.ErrTOTPCodeUsed
+	}
+	return nil
+}
+
+func (s *Storage) UseRecoveryCode(ctx context.Context, userID, codeHash string) error {
+	res, err := s.db.ExecContext(ctx, `
+        UPDATE user_recovery_codes
+        SET used_at = NOW()
+        WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		userID, codeHash)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to use recovery code")
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		s.logger.WithContext(ctx).WithField("user_id", userID).Error("recovery code invalid or used")
+		return storages.ErrRecoveryCodeInvalid
+	}
+
+	s.logger.WithContext(ctx).WithField("user_id", userID).Info("recovery code used")
+	return nil
+}
+
+func (s *Storage) DeleteTOTP(ctx context.Context, userID string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to begin transaction for totp removal")
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to delete recovery codes")
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to delete totp")
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to commit totp removal transaction")
+		return err
+	}
+
+	s.logger.WithContext(ctx).WithField("user_id", userID).Info("totp removed from database")
+	return nil
+}
+
+// CreateMFAChallenge сохраняет jti выданного mfa_token и заодно удаляет
+// истёкшие попытки пользователя.
+func (s *Storage) CreateMFAChallenge(ctx context.Context, id, userID string, ttl time.Duration) error {
+	if _, err := s.db.ExecContext(ctx, `
+        DELETE FROM mfa_challenges
+        WHERE user_id = $1 AND expires_at <= NOW()`,
+		userID); err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to delete expired mfa challenges")
+		return err
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+        INSERT INTO mfa_challenges (id, user_id, created_at, expires_at)
+        VALUES ($1, $2, NOW(), NOW() + make_interval(secs => $3))`,
+		id, userID, ttl.Seconds())
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to create mfa challenge")
+		return err
+	}
+	return nil
+}
+
+// TakeMFAAttempt атомарно засчитывает попытку ввода кода. Использованный,
+// истёкший или исчерпавший maxAttempts mfa_token больше не принимается.
+func (s *Storage) TakeMFAAttempt(ctx context.Context, id, userID string, maxAttempts int) error {
+	res, err := s.db.ExecContext(ctx, `
+        UPDATE mfa_challenges
+        SET attempts = attempts + 1
+        WHERE id = $1 AND user_id = $2 AND used_at IS NULL
+          AND expires_at > NOW() AND attempts < $3`,
+		id, userID, maxAttempts)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to take mfa attempt")
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return storages.ErrMFAChallengeInvalid
+	}
+	return nil
+}
+
+// CompleteMFAChallenge помечает mfa_token использованным после успешного входа.
+func (s *Storage) CompleteMFAChallenge(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `
+        UPDATE mfa_challenges
+        SET used_at = NOW()
+        WHERE id = $1 AND used_at IS NULL`,
+		id)
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to complete mfa challenge")
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return storages.ErrMFAChallengeInvalid
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+	"github.com/sirupsen/logrus"
+)
+
+// recordTransaction пишет операцию в журнал в той же транзакции, что и
+// изменение баланса, чтобы журнал не расходился с балансами. Возвращает
+// запись с id и временем операции.
+func (s *Storage) recordTransaction(ctx context.Context, tx *sql.Tx, userID string, t storages.Transaction) (storages.Transaction, error) {
+	err := tx.QueryRowContext(ctx, `
+        INSERT INTO transactions (user_id, type, currency, amount, fee, to_currency, to_amount, rate, created_at)
+        VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, 0), NULLIF($8, 0), NOW())
+        RETURNING id, created_at`,
+		userID, t.Type, t.Currency, t.Amount, t.Fee, t.ToCurrency, t.ToAmount, t.Rate).Scan(&t.ID, &t.CreatedAt)
+	if err != nil {
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"user_id": userID,
+			"type":    t.Type,
+		}).WithError(err).Error("failed to record transaction")
+	}
+	return t, err
+}
+
+func (s *Storage) ListTransactions(ctx context.Context, filter storages.TransactionFilter) ([]storages.Transaction, error) {
+	rows, err := s.db.QueryContext(ctx, `
+        SELECT id, type, currency, amount, fee, COALESCE(to_currency, ''), COALESCE(to_amount, 0), COALESCE(rate, 0), created_at
+        FROM transactions
+        WHERE user_id = $1 AND ($2::BIGINT = 0 OR id < $2)
+        ORDER BY id DESC
+        LIMIT $3`,
+		filter.UserID, filter.BeforeID, filter.Limit)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", filter.UserID).WithError(err).Error("failed to query transactions")
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := []storages.Transaction{}
+	for rows.Next() {
+		var t storages.Transaction
+		if err := rows.Scan(&t.ID, &t.Type, &t.Currency, &t.Amount, &t.Fee, &t.ToCurrency, &t.ToAmount, &t.Rate, &t.CreatedAt); err != nil {
+			s.logger.WithContext(ctx).WithField("user_id", filter.UserID).WithError(err).Error("failed to scan transaction")
+			return nil, err
+		}
+		transactions = append(transactions, t)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", filter.UserID).WithError(err).Error("failed to iterate transactions")
+		return nil, err
+	}
+
+	return transactions, nil
+}
@@ -0,0 +1,309 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// enqueueWebhookEvent ставит событие в очередь доставки на все вебхуки
+// пользователя, подписанные на него.
+func (s *Storage) enqueueWebhookEvent(ctx context.Context, tx *sql.Tx, event storages.Event, payload []byte) error {
+	_, err := tx.ExecContext(ctx, `
+        INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+        SELECT id, $2, $3, $4, 'pending', NOW(), NOW()
+        FROM webhook_endpoints
+        WHERE user_id = $1 AND $3 = ANY(events)`,
+		event.UserID, event.ID, event.Type, string(payload))
+	if err != nil {
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"user_id":    event.UserID,
+			"event_type": event.Type,
+		}).WithError(err).Error("failed to enqueue webhook event")
+	}
+	return err
+}
+
+func (s *Storage) CreateWebhook(ctx context.Context, endpoint storages.WebhookEndpoint, encryptedSecret string) (storages.WebhookEndpoint, error) {
+	err := s.db.QueryRowContext(ctx, `
+        INSERT INTO webhook_endpoints (user_id, url, secret, events, created_at)
+        VALUES ($1, $2, $3, $4, NOW())
+        RETURNING id, created_at`,
+		endpoint.UserID, endpoint.URL, encryptedSecret, pq.Array(endpoint.Events)).Scan(&endpoint.ID, &endpoint.CreatedAt)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", endpoint.UserID).WithError(err).Error("failed to create webhook")
+		return storages.WebhookEndpoint{}, err
+	}
+
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"user_id":    endpoint.UserID,
+		"webhook_id": endpoint.ID,
+	}).Info("webhook created in database")
+	return endpoint, nil
+}
+
+func (s *Storage) ListWebhooks(ctx context.Context, userID string) ([]storages.WebhookEndpoint, error) {
+	rows, err := s.db.QueryContext(ctx, `
+        SELECT id, user_id, url, events, created_at
+        FROM webhook_endpoints
+        WHERE user_id = $1
+        ORDER BY id`,
+		userID)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to query webhooks")
+		return nil, err
+	}
+	defer rows.Close()
+
+	endpoints := []storages.WebhookEndpoint{}
+	for rows.Next() {
+		var e storages.WebhookEndpoint
+		if err := rows.Scan(&e.ID, &e.UserID, &e.URL, pq.Array(&e.Events), &e.CreatedAt); err != nil {
+			s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to scan webhook")
+			return nil, err
+		}
+		endpoints = append(endpoints, e)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.WithContext(ctx).WithField("user_id", userID).WithError(err).Error("failed to iterate webhooks")
+		return nil, err
+	}
+
+	return endpoints, nil
+}
+
+// DeleteWebhook удаляет вебхук вместе с историей и очередью его доставок.
+func (s *Storage) DeleteWebhook(ctx context.Context, userID string, endpointID int) error {
+	res, err := s.db.ExecContext(ctx, `
+        DELETE FROM webhook_endpoints
+        WHERE id = $1 AND user_id = $2`,
+		endpointID, userID)
+	if err != nil {
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"user_id":    userID,
+			"webhook_id": endpointID,
+		}).WithError(err).Error("failed to delete webhook")
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return storages.ErrWebhookNotFound
+	}
+
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"user_id":    userID,
+		"webhook_id": endpointID,
+	}).Info("webhook deleted from database")
+	return nil
+}
+
+// ListWebhookDeliveries возвращает доставки вебхука от новых к старым.
+// Чужой вебхук не отличается от несуществующего.
+func (s *Storage) ListWebhookDeliveries(ctx context.Context, filter storages.DeliveryFilter) ([]storages.WebhookDelivery, error) {
+	var owned bool
+	err := s.db.QueryRowContext(ctx, `
+        SELECT EXISTS (SELECT 1 FROM webhook_endpoints WHERE id = $1 AND user_id = $2)`,
+		filter.EndpointID, filter.UserID).Scan(&owned)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("webhook_id", filter.EndpointID).WithError(err).Error("failed to check webhook owner")
+		return nil, err
+	}
+	if !owned {
+		return nil, storages.ErrWebhookNotFound
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+        SELECT id, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+               COALESCE(last_status_code, 0), COALESCE(last_error, ''), created_at, delivered_at
+        FROM webhook_deliveries
+        WHERE endpoint_id = $1
+          AND ($2::TEXT = '' OR status = $2)
+          AND ($3::BIGINT = 0 OR id < $3)
+        ORDER BY id DESC
+        LIMIT $4`,
+		filter.EndpointID, filter.Status, filter.BeforeID, filter.Limit)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("webhook_id", filter.EndpointID).WithError(err).Error("failed to query webhook deliveries")
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []storages.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			s.logger.WithContext(ctx).WithField("webhook_id", filter.EndpointID).WithError(err).Error("failed to scan webhook delivery")
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.WithContext(ctx).WithField("webhook_id", filter.EndpointID).WithError(err).Error("failed to iterate webhook deliveries")
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// ReplayWebhookDelivery ставит доставку в очередь заново с обнулённым
+// счётчиком попыток, в каком бы статусе она ни была.
+func (s *Storage) ReplayWebhookDelivery(ctx context.Context, userID string, endpointID int, deliveryID int64) error {
+	res, err := s.db.ExecContext(ctx, `
+        UPDATE webhook_deliveries d
+        SET status = 'pending', attempts = 0, next_attempt_at = NOW(), last_error = NULL, last_status_code = NULL, delivered_at = NULL
+        FROM webhook_endpoints e
+        WHERE d.id = $1 AND d.endpoint_id = $2 AND e.id = d.endpoint_id AND e.user_id = $3`,
+		deliveryID, endpointID, userID)
+	if err != nil {
+		s.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"webhook_id":  endpointID,
+			"delivery_id": deliveryID,
+		}).WithError(err).Error("failed to replay webhook delivery")
+		return err
+	}
+
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return storages.ErrDeliveryNotFound
+	}
+	return nil
+}
+
+// ReplayDeadWebhookDeliveries возвращает в очередь все доставки вебхука,
+// исчерпавшие попытки, например после восстановления сервиса получателя.
+func (s *Storage) ReplayDeadWebhookDeliveries(ctx context.Context, userID string, endpointID int) (int64, error) {
+	var owned bool
+	err := s.db.QueryRowContext(ctx, `
+        SELECT EXISTS (SELECT 1 FROM webhook_endpoints WHERE id = $1 AND user_id = $2)`,
+		endpointID, userID).Scan(&owned)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("webhook_id", endpointID).WithError(err).Error("failed to check webhook owner")
+		return 0, err
+	}
+	if !owned {
+		return 0, storages.ErrWebhookNotFound
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+        UPDATE webhook_deliveries
+        SET status = 'pending', attempts = 0, next_attempt_at = NOW(), last_error = NULL, last_status_code = NULL
+        WHERE endpoint_id = $1 AND status = 'dead'`,
+		endpointID)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("webhook_id", endpointID).WithError(err).Error("failed to replay dead webhook deliveries")
+		return 0, err
+	}
+
+	replayed, _ := res.RowsAffected()
+	s.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"webhook_id": endpointID,
+		"replayed":   replayed,
+	}).Info("dead webhook deliveries requeued")
+	return replayed, nil
+}
+
+// ClaimWebhookDeliveries берёт до limit доставок, срок которых наступил, и
+// откладывает их на lease, чтобы другие экземпляры сервиса их не взяли.
+// Если экземпляр упадёт во время доставки, после lease её возьмёт другой.
+func (s *Storage) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]storages.WebhookJob, error) {
+	rows, err := s.db.QueryContext(ctx, `
+        UPDATE webhook_deliveries d
+        SET attempts = d.attempts + 1, next_attempt_at = NOW() + make_interval(secs => $2)
+        FROM webhook_endpoints e
+        WHERE e.id = d.endpoint_id AND d.id IN (
+            SELECT id FROM webhook_deliveries
+            WHERE status = 'pending' AND next_attempt_at <= NOW()
+            ORDER BY next_attempt_at
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED)
+        RETURNING d.id, d.endpoint_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at,
+                  COALESCE(d.last_status_code, 0), COALESCE(d.last_error, ''), d.created_at, d.delivered_at,
+                  e.url, e.secret`,
+		limit, lease.Seconds())
+	if err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to claim webhook deliveries")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []storages.WebhookJob
+	for rows.Next() {
+		var job storages.WebhookJob
+		d := &job.Delivery
+		var payload []byte
+		var deliveredAt sql.NullTime
+		if err := rows.Scan(&d.ID, &d.EndpointID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&d.LastStatusCode, &d.LastError, &d.CreatedAt, &deliveredAt, &job.URL, &job.EncryptedSecret); err != nil {
+			s.logger.WithContext(ctx).WithError(err).Error("failed to scan webhook job")
+			return nil, err
+		}
+		d.Payload = payload
+		d.DeliveredAt = nullTimePtr(deliveredAt)
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.WithContext(ctx).WithError(err).Error("failed to iterate webhook jobs")
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+func (s *Storage) CompleteWebhookDelivery(ctx context.Context, deliveryID int64, attempt storages.DeliveryAttempt) error {
+	_, err := s.db.ExecContext(ctx, `
+        UPDATE webhook_deliveries
+        SET status = 'delivered', delivered_at = NOW(), last_status_code = $2, last_error = NULL
+        WHERE id = $1`,
+		deliveryID, attempt.StatusCode)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("delivery_id", deliveryID).WithError(err).Error("failed to mark webhook delivered")
+	}
+	return err
+}
+
+// RetryWebhookDelivery записывает неудачную попытку и назначает следующую
+// через delay.
+func (s *Storage) RetryWebhookDelivery(ctx context.Context, deliveryID int64, attempt storages.DeliveryAttempt, delay time.Duration) error {
+	_, err := s.db.ExecContext(ctx, `
+        UPDATE webhook_deliveries
+        SET next_attempt_at = NOW() + make_interval(secs => $4), last_status_code = NULLIF($2, 0), last_error = $3
+        WHERE id = $1`,
+		deliveryID, attempt.StatusCode, attempt.Error, delay.Seconds())
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("delivery_id", deliveryID).WithError(err).Error("failed to schedule webhook retry")
+	}
+	return err
+}
+
+// DeadLetterWebhookDelivery переводит доставку в статус dead: воркер её
+// больше не берёт, вернуть в очередь можно через API.
+func (s *Storage) DeadLetterWebhookDelivery(ctx context.Context, deliveryID int64, attempt storages.DeliveryAttempt) error {
+	_, err := s.db.ExecContext(ctx, `
+        UPDATE webhook_deliveries
+        SET status = 'dead', last_status_code = NULLIF($2, 0), last_error = $3
+        WHERE id = $1`,
+		deliveryID, attempt.StatusCode, attempt.Error)
+	if err != nil {
+		s.logger.WithContext(ctx).WithField("delivery_id", deliveryID).WithError(err).Error("failed to dead-letter webhook delivery")
+	}
+	return err
+}
+
+func scanDelivery(row rowScanner) (storages.WebhookDelivery, error) {
+	var d storages.WebhookDelivery
+	// payload сканируется в []byte: database/sql копирует только его, а
+	// буфер драйвера переиспользуется для следующей строки.
+	var payload []byte
+	var deliveredAt sql.NullTime
+	err := row.Scan(&d.ID, &d.EndpointID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&d.LastStatusCode, &d.LastError, &d.CreatedAt, &deliveredAt)
+	if err != nil {
+		return storages.WebhookDelivery{}, err
+	}
+	d.Payload = payload
+	d.DeliveredAt = nullTimePtr(deliveredAt)
+	return d, nil
+}
@@ -1,19 +1,322 @@
 package storages
 
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	ErrTOTPNotEnrolled     = errors.New("totp not enrolled")
+	ErrTOTPAlreadyEnabled  = errors.New("totp already enabled")
+	ErrTOTPCodeUsed        = errors.New("totp code already used")
+	ErrRecoveryCodeInvalid = errors.New("recovery code invalid or used")
+	ErrTokenInvalid        = errors.New("token invalid, expired or used")
+	ErrMFAChallengeInvalid = errors.New("mfa challenge invalid, expired, used or out of attempts")
+	ErrAPIKeyNotFound      = errors.New("api key not found")
+	ErrAPIKeyInvalid       = errors.New("api key invalid, expired or revoked")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrSessionInvalid      = errors.New("session invalid, expired or revoked")
+	ErrAuditChainBroken    = errors.New("audit log hash chain broken")
+	ErrInsufficientFunds   = errors.New("insufficient funds")
+	ErrWebhookNotFound     = errors.New("webhook endpoint not found")
+	ErrDeliveryNotFound    = errors.New("webhook delivery not found")
+	ErrOutboxLocked        = errors.New("outbox is published by another instance")
+)
+
+// Типы операций в журнале transactions
+const (
+	TransactionDeposit  = "deposit"
+	TransactionWithdraw = "withdraw"
+	TransactionExchange = "exchange"
+)
+
+// События кошелька: отправляются на вебхуки и публикуются через outbox
+const (
+	EventDepositCompleted    = "deposit.completed"
+	EventWithdrawalCompleted = "withdrawal.completed"
+	EventExchangeCompleted   = "exchange.completed"
+	// Переводов между пользователями пока нет, подписаться на событие
+	// можно заранее.
+	EventTransferReceived = "transfer.received"
+)
+
+// События журнала аудита об операциях с деньгами. Пишутся хранилищем в
+// транзакции операции, остальные события аудита — обработчиками.
+const (
+	AuditDeposit  = "wallet.deposit"
+	AuditWithdraw = "wallet.withdraw"
+	AuditExchange = "wallet.exchange"
+)
+
+// Статусы доставки вебхука
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// Назначения одноразовых токенов из писем
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposePasswordReset = "password_reset"
+)
+
 type Storage interface {
-	RegisterUser(username, password, email string) error
-	GetUser(username string) (User, error)
-	GetBalance(userID string) (map[string]float64, error)
-	Deposit(userID, currency string, amount float64) error
-	Withdraw(userID, currency string, amount float64) error
-	Exchange(userID, fromCurrency, toCurrency string, amount, rate float64) error
-	GetExchangeRates() (map[string]float64, error)
-	GetExchangeRate(from, to string) (float64, error)
+	RegisterUser(ctx context.Context, username, passwordHash, email string) error
+	GetUser(ctx context.Context, username string) (User, error)
+	GetUserByID(ctx context.Context, userID string) (User, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	MarkEmailVerified(ctx context.Context, userID string) error
+	UpdatePassword(ctx context.Context, userID, passwordHash string) error
+	UpgradePasswordHash(ctx context.Context, userID, oldHash, newHash string) error
+	GetTokenVersion(ctx context.Context, userID string) (int, error)
+	CreateUserToken(ctx context.Context, userID, purpose, tokenHash string, ttl time.Duration) error
+	ConsumeUserToken(ctx context.Context, purpose, tokenHash string) (string, error)
+	GetBalance(ctx context.Context, userID string) (map[string]float64, error)
+	// Комиссия fee за пополнение и обмен удерживается из amount, за вывод
+	// списывается сверх amount.
+	Deposit(ctx context.Context, userID, currency string, amount, fee float64) error
+	Withdraw(ctx context.Context, userID, currency string, amount, fee float64) error
+	Exchange(ctx context.Context, userID, fromCurrency, toCurrency string, amount, fee, rate float64) error
+	GetExchangeRates(ctx context.Context) (map[string]float64, error)
+	GetExchangeRate(ctx context.Context, from, to string) (float64, error)
+	ListTransactions(ctx context.Context, filter TransactionFilter) ([]Transaction, error)
+
+	SaveTOTPSecret(ctx context.Context, userID, encryptedSecret string) error
+	GetTOTP(ctx context.Context, userID string) (TOTP, error)
+	ConfirmTOTP(ctx context.Context, userID string, step int64, recoveryCodeHashes []string) error
+	UseTOTPStep(ctx context.Context, userID string, step int64) error
+	UseRecoveryCode(ctx context.Context, userID, codeHash string) error
+	DeleteTOTP(ctx context.Context, userID string) error
+	CreateMFAChallenge(ctx context.Context, id, userID string, ttl time.Duration) error
+	TakeMFAAttempt(ctx context.Context, id, userID string, maxAttempts int) error
+	CompleteMFAChallenge(ctx context.Context, id string) error
+
+	CreateAPIKey(ctx context.Context, key APIKey, keyHash string, ttl time.Duration) (APIKey, error)
+	ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID string, keyID int) error
+	AuthenticateAPIKey(ctx context.Context, keyHash string) (APIKey, error)
+
+	CreateSession(ctx context.Context, session Session, ttl time.Duration) (Session, error)
+	ValidateSession(ctx context.Context, sessionID, userID string, tokenVersion int) error
+	ListSessions(ctx context.Context, userID string) ([]Session, error)
+	RefreshSession(ctx context.Context, userID, sessionID string, ttl time.Duration) (Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID string) error
+	RevokeOtherSessions(ctx context.Context, userID, keepSessionID string) error
+
+	CreateWebhook(ctx context.Context, endpoint WebhookEndpoint, encryptedSecret string) (WebhookEndpoint, error)
+	ListWebhooks(ctx context.Context, userID string) ([]WebhookEndpoint, error)
+	DeleteWebhook(ctx context.Context, userID string, endpointID int) error
+	ListWebhookDeliveries(ctx context.Context, filter DeliveryFilter) ([]WebhookDelivery, error)
+	ReplayWebhookDelivery(ctx context.Context, userID string, endpointID int, deliveryID int64) error
+	ReplayDeadWebhookDeliveries(ctx context.Context, userID string, endpointID int) (int64, error)
+
+	AppendAuditEvent(ctx context.Context, event AuditEvent) error
+	ListAuditEvents(ctx context.Context, filter AuditFilter) ([]AuditEvent, error)
+	VerifyAuditChain(ctx context.Context) (int, error)
 }
 
 type User struct {
-	ID           int
-	Username     string
-	PasswordHash string
-	Email        string
+	ID            int
+	Username      string
+	PasswordHash  string
+	Email         string
+	EmailVerified bool
+	// TokenVersion увеличивается при смене пароля и отзывает ранее выданные JWT
+	TokenVersion int
+	IsAdmin      bool
+}
+
+type TOTP struct {
+	UserID          string
+	EncryptedSecret string
+	Confirmed       bool
+	LastUsedStep    int64
+}
+
+// APIKey — ключ доступа для межсервисных клиентов. Сам ключ не хранится,
+// только его хэш; Prefix позволяет узнать ключ в списке.
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     string     `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Session — запись о выданном JWT. Отзыв сессии делает токен
+// недействительным до истечения его срока.
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     string    `json:"-"`
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// AuditEvent — запись журнала событий безопасности. Пустые ActorUserID,
+// SubjectUserID и нулевой ActorAPIKeyID означают отсутствие значения.
+type AuditEvent struct {
+	ID            int64                  `json:"id"`
+	OccurredAt    time.Time              `json:"occurred_at"`
+	EventType     string                 `json:"event_type"`
+	ActorUserID   string                 `json:"actor_user_id,omitempty"`
+	ActorAPIKeyID int                    `json:"actor_api_key_id,omitempty"`
+	SubjectUserID string                 `json:"subject_user_id,omitempty"`
+	IP            string                 `json:"ip"`
+	UserAgent     string                 `json:"user_agent"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// AuditActor — кто и откуда выполняет операцию. Транспорт кладёт его в
+// контекст запроса, хранилище переносит в записи аудита.
+type AuditActor struct {
+	UserID string
+	// APIKeyID — ключ, которым аутентифицирован запрос; 0 для JWT
+	APIKeyID  int
+	IP        string
+	UserAgent string
+}
+
+type auditActorKey struct{}
+
+func WithAuditActor(ctx context.Context, actor AuditActor) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// AuditActorFrom возвращает AuditActor из контекста или пустое значение.
+func AuditActorFrom(ctx context.Context) AuditActor {
+	actor, _ := ctx.Value(auditActorKey{}).(AuditActor)
+	return actor
+}
+
+type AuditFilter struct {
+	SubjectUserID string
+	EventType     string
+	// BeforeID служит курсором: возвращаются записи с id меньше заданного
+	BeforeID int64
+	Limit    int
+}
+
+// Transaction — операция по кошельку. Для обмена Currency и Amount —
+// списанная валюта и сумма, ToCurrency и ToAmount — зачисленные. Fee —
+// комиссия в валюте Currency.
+type Transaction struct {
+	ID         int64     `json:"id"`
+	Type       string    `json:"type"`
+	Currency   string    `json:"currency"`
+	Amount     float64   `json:"amount"`
+	Fee        float64   `json:"fee,omitempty"`
+	ToCurrency string    `json:"to_currency,omitempty"`
+	ToAmount   float64   `json:"to_amount,omitempty"`
+	Rate       float64   `json:"rate,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type TransactionFilter struct {
+	UserID string
+	// BeforeID служит курсором: возвращаются записи с id меньше заданного
+	BeforeID int64
+	Limit    int
+}
+
+// WebhookEndpoint — адрес, на который отправляются события пользователя.
+// Секрет для подписи хранится зашифрованным и в ответы не попадает.
+type WebhookEndpoint struct {
+	ID        int       `json:"id"`
+	UserID    string    `json:"-"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Event — событие кошелька: тело запроса вебхука и сообщения в брокере.
+// ID одинаков у всех повторов доставки, по нему получатель отбрасывает
+// дубли.
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	UserID    string      `json:"user_id"`
+	Data      interface{} `json:"data"`
+}
+
+// WebhookDelivery — доставка события на один адрес.
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	EndpointID     int             `json:"endpoint_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+}
+
+type DeliveryFilter struct {
+	UserID     string
+	EndpointID int
+	// Пустой Status — доставки в любом статусе
+	Status string
+	// BeforeID служит курсором: возвращаются записи с id меньше заданного
+	BeforeID int64
+	Limit    int
+}
+
+// WebhookJob — доставка, взятая воркером, вместе с адресом и зашифрованным
+// секретом вебхука.
+type WebhookJob struct {
+	Delivery        WebhookDelivery
+	URL             string
+	EncryptedSecret string
+}
+
+// DeliveryAttempt — результат попытки доставки. StatusCode равен нулю, если
+// ответа не было.
+type DeliveryAttempt struct {
+	StatusCode int
+	Error      string
+}
+
+// OutboxMessage — событие из таблицы outbox, ещё не опубликованное в брокер.
+// Key — идентификатор пользователя, порядок сохраняется в пределах ключа.
+type OutboxMessage struct {
+	ID        int64
+	EventID   string
+	Key       string
+	Type      string
+	Payload   json.RawMessage
+	CreatedAt time.Time
+	Attempts  int
+}
+
+// OutboxLock — право публиковать outbox. Его держит один экземпляр сервиса,
+// поэтому события одного пользователя не публикуются параллельно. Каждый
+// метод — отдельный короткий запрос, транзакция между ними не открыта.
+type OutboxLock interface {
+	// Pending возвращает до limit неопубликованных событий в порядке id.
+	// События пользователя, у которого более раннее событие ждёт повтора,
+	// пропускаются.
+	Pending(ctx context.Context, limit int) ([]OutboxMessage, error)
+	MarkPublished(ctx context.Context, ids []int64) error
+	// MarkFailed откладывает повтор события на retryAfter.
+	MarkFailed(ctx context.Context, id int64, reason string, retryAfter time.Duration) error
+	// MarkDead переносит событие в dead letter: оно больше не публикуется
+	// и не задерживает следующие события пользователя.
+	MarkDead(ctx context.Context, id int64, reason string) error
+	// Release отпускает право публикации, в том числе после ошибки соединения.
+	Release()
 }
@@ -0,0 +1,164 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// bufferSize — сколько событий ждут отправки одному клиенту. Клиент,
+// который не успевает их читать, отключается и переподключается сам.
+const bufferSize = 16
+
+// retryDelay — пауза перед повторной подпиской на события после ошибки.
+const retryDelay = 5 * time.Second
+
+// Source — поток событий кошелька со всех экземпляров сервиса, его
+// реализует postgres.Storage через LISTEN/NOTIFY.
+type Source interface {
+	ListenEvents(ctx context.Context, handle func(payload []byte), resync func()) error
+}
+
+// Message — событие для подписчика. Resync означает, что события могли
+// потеряться и состояние нужно перечитать; ID и Event в нём пустые.
+type Message struct {
+	ID     string
+	Event  json.RawMessage
+	Resync bool
+}
+
+// Hub раздаёт события кошелька подключённым клиентам этого экземпляра.
+type Hub struct {
+	mu     sync.Mutex
+	subs   map[string]map[*Subscription]struct{}
+	closed bool
+	logger *logrus.Logger
+}
+
+// Subscription — подписка одного клиента на события пользователя. Канал C
+// закрывается при Close, при отключении медленного клиента и при
+// остановке сервиса.
+type Subscription struct {
+	C      <-chan Message
+	c      chan Message
+	userID string
+	hub    *Hub
+}
+
+func NewHub(logger *logrus.Logger) *Hub {
+	return &Hub{
+		subs:   make(map[string]map[*Subscription]struct{}),
+		logger: logger,
+	}
+}
+
+// Run получает события из source до отмены ctx и раздаёт их подписчикам.
+func (h *Hub) Run(ctx context.Context, source Source) {
+	for ctx.Err() == nil {
+		if err := source.ListenEvents(ctx, h.Dispatch, h.Resync); err != nil {
+			h.logger.WithError(err).Error("wallet event stream failed, retrying")
+			// За время без подписки события могли пройти мимо.
+			h.Resync()
+			select {
+			case <-ctx.Done():
+			case <-time.After(retryDelay):
+			}
+		}
+	}
+}
+
+// Subscribe подписывает клиента на события пользователя. После остановки
+// сервиса возвращается подписка с уже закрытым каналом.
+func (h *Hub) Subscribe(userID string) *Subscription {
+	c := make(chan Message, bufferSize)
+	sub := &Subscription{C: c, c: c, userID: userID, hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(c)
+		return sub
+	}
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[*Subscription]struct{})
+	}
+	h.subs[userID][sub] = struct{}{}
+	return sub
+}
+
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// Dispatch отправляет событие подписчикам его пользователя.
+func (h *Hub) Dispatch(payload []byte) {
+	var event struct {
+		ID     string `json:"id"`
+		UserID string `json:"user_id"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil || event.UserID == "" {
+		h.logger.WithError(err).Warn("skipping malformed wallet event")
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs[event.UserID] {
+		h.send(sub, Message{ID: event.ID, Event: payload})
+	}
+}
+
+// Resync просит всех подписчиков перечитать состояние.
+func (h *Hub) Resync() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, subs := range h.subs {
+		for sub := range subs {
+			h.send(sub, Message{Resync: true})
+		}
+	}
+}
+
+// Close отключает всех подписчиков. Вызывается при остановке сервиса:
+// иначе открытые потоки не дали бы HTTP-серверу завершиться.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for _, subs := range h.subs {
+		for sub := range subs {
+			h.remove(sub)
+		}
+	}
+}
+
+// send вызывается под h.mu.
+func (h *Hub) send(sub *Subscription, m Message) {
+	select {
+	case sub.c <- m:
+	default:
+		h.logger.WithField("user_id", sub.userID).Warn("stream client is too slow, disconnecting")
+		h.remove(sub)
+	}
+}
+
+// remove вызывается под h.mu.
+func (h *Hub) remove(sub *Subscription) {
+	subs, ok := h.subs[sub.userID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subs, sub.userID)
+	}
+	close(sub.c)
+}
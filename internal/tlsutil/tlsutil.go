@@ -0,0 +1,144 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+// CertReloader держит сертификат с ключом и перечитывает их при ротации
+// файлов. Новые соединения получают новый сертификат, открытые не рвутся.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+	modTime  time.Time
+	logger   *logrus.Logger
+}
+
+func NewCertReloader(certFile, keyFile string, logger *logrus.Logger) (*CertReloader, error) {
+	r := &CertReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload загружает пару заново. При ошибке остаётся прежний сертификат.
+func (r *CertReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load key pair %s: %w", r.certFile, err)
+	}
+	r.cert.Store(&cert)
+	r.modTime = r.latestModTime()
+	return nil
+}
+
+// Watch проверяет время изменения файлов раз в interval и перечитывает
+// сертификат, если они обновились.
+func (r *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.latestModTime().After(r.modTime) {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				r.logger.WithField("cert_file", r.certFile).WithError(err).Error("failed to reload certificate, keeping current one")
+				continue
+			}
+			r.logger.WithField("cert_file", r.certFile).Info("certificate reloaded")
+		}
+	}
+}
+
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+func (r *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+func (r *CertReloader) latestModTime() time.Time {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// ServerConfig собирает tls.Config для HTTP-сервера.
+func ServerConfig(cfg config.ServerTLSConfig, certs *CertReloader) (*tls.Config, error) {
+	minVersion, err := parseVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: certs.GetCertificate,
+	}, nil
+}
+
+// ClientConfig собирает tls.Config для gRPC-клиента. Без CAFile сертификат
+// сервера проверяется по системным корневым сертификатам; с CertFile и
+// KeyFile клиент предъявляет свой сертификат (mTLS), который тоже
+// перечитывается при ротации — для этого возвращается CertReloader.
+func ClientConfig(cfg config.ClientTLSConfig, logger *logrus.Logger) (*tls.Config, *CertReloader, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: cfg.ServerName,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, nil, errors.New("no certificates found in CA file " + cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile == "" {
+		return tlsConfig, nil, nil
+	}
+	certs, err := NewCertReloader(cfg.CertFile, cfg.KeyFile, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	tlsConfig.GetClientCertificate = certs.GetClientCertificate
+	return tlsConfig, certs, nil
+}
+
+func parseVersion(version string) (uint16, error) {
+	switch version {
+	case "1.2", "":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version %q", version)
+	}
+}
@@ -0,0 +1,48 @@
+package totp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+// Cipher шифрует TOTP-секреты перед записью в базу (AES-256-GCM).
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher выводит 256-битный ключ из произвольной строки.
+func NewCipher(key string) *Cipher {
+	sum := sha256.Sum256([]byte(key))
+	block, _ := aes.NewCipher(sum[:]) // ошибка возможна только при неверной длине ключа
+	aead, _ := cipher.NewGCM(block)
+	return &Cipher{aead: aead}
+}
+
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (c *Cipher) Decrypt(ciphertext string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+	nonce, sealed := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
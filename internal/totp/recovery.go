@@ -0,0 +1,39 @@
+package totp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+	recoveryAlphabet   = "abcdefghijkmnpqrstuvwxyz23456789" // 32 символа, без l, o, 0 и 1
+)
+
+// GenerateRecoveryCodes возвращает набор одноразовых кодов восстановления.
+// Пользователю они показываются один раз, в базе хранятся только хэши.
+func GenerateRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, recoveryCodeLength)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		for j, b := range raw {
+			raw[j] = recoveryAlphabet[int(b)%len(recoveryAlphabet)]
+		}
+		codes[i] = string(raw[:5]) + "-" + string(raw[5:])
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode нормализует код и возвращает его SHA-256. Коды
+// случайные и длинные, поэтому медленный хэш здесь не нужен.
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
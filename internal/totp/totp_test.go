@@ -0,0 +1,102 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// Секрет из приложения B RFC 6238 ("12345678901234567890") в base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// Векторы RFC 6238 для SHA-1; в RFC коды 8-значные, у нас последние 6 цифр.
+func TestCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d: %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateWindow(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	tests := []struct {
+		name   string
+		offset int64
+		ok     bool
+	}{
+		{"previous step", -1, true},
+		{"current step", 0, true},
+		{"next step", 1, true},
+		{"two steps behind", -2, false},
+		{"two steps ahead", 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Code(rfcSecret, current+tt.offset)
+			if err != nil {
+				t.Fatalf("Code: %v", err)
+			}
+			step, ok := Validate(rfcSecret, code, now)
+			if ok != tt.ok {
+				t.Fatalf("Validate ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && step != current+tt.offset {
+				t.Errorf("Validate step = %d, want %d", step, current+tt.offset)
+			}
+		})
+	}
+}
+
+// Повтор кода отсекает вызывающая сторона по last_used_step: Validate
+// должен возвращать для него тот же шаг, пока код в окне.
+func TestValidateReplayStep(t *testing.T) {
+	issued := time.Unix(1111111111, 0)
+	code, err := Code(rfcSecret, Step(issued))
+	if err != nil {
+		t.Fatalf("Code: %v", err)
+	}
+
+	first, ok := Validate(rfcSecret, code, issued)
+	if !ok {
+		t.Fatal("first use rejected")
+	}
+	replay, ok := Validate(rfcSecret, code, issued.Add(period*time.Second))
+	if !ok {
+		t.Fatal("code rejected within skew window")
+	}
+	if replay != first {
+		t.Errorf("replayed code matched step %d, want %d", replay, first)
+	}
+	if _, ok := Validate(rfcSecret, code, issued.Add(2*period*time.Second)); ok {
+		t.Error("code accepted outside skew window")
+	}
+}
+
+func TestValidateMalformed(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := Validate(rfcSecret, code, now); ok {
+			t.Errorf("Validate(%q) accepted", code)
+		}
+	}
+	if _, ok := Validate("not base32!", "050471", now); ok {
+		t.Error("Validate accepted code for malformed secret")
+	}
+}
@@ -0,0 +1,218 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError описывает ошибку в конкретном поле запроса.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// bodyField — имя «поля» для ошибок, относящихся к телу запроса целиком.
+const bodyField = "body"
+
+// MaxAmount — верхняя граница суммы одной операции.
+const MaxAmount = 1e12
+
+var currencies = map[string]bool{"USD": true, "RUB": true, "EUR": true}
+
+// IsCurrency сообщает, поддерживается ли код валюты.
+func IsCurrency(code string) bool {
+	return currencies[code]
+}
+
+// IsMoney проверяет сумму операции: положительная, не больше MaxAmount и не
+// мельче копейки/цента.
+func IsMoney(amount float64) bool {
+	if math.IsNaN(amount) || amount <= 0 || amount > MaxAmount {
+		return false
+	}
+	cents := amount * 100
+	return math.Abs(cents-math.Round(cents)) < 1e-6
+}
+
+// Валидаторы регистрируются в движке gin, поэтому теги binding:"currency"
+// и binding:"money" работают в любых структурах запросов.
+func init() {
+	engine, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		panic("validation: unexpected gin validator engine")
+	}
+
+	// В ошибках поля называются так же, как в JSON.
+	engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+
+	must(engine.RegisterValidation("currency", func(fl validator.FieldLevel) bool {
+		return IsCurrency(fl.Field().String())
+	}))
+	must(engine.RegisterValidation("money", func(fl validator.FieldLevel) bool {
+		return IsMoney(fl.Field().Float())
+	}))
+}
+
+func must(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+// BindJSON строго разбирает тело запроса в obj и проверяет теги binding.
+// Неизвестные поля, лишние данные после объекта и поля неверного типа
+// считаются ошибками. Возвращает nil, если запрос корректен.
+func BindJSON(c *gin.Context, obj interface{}) []FieldError {
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(obj); err != nil {
+		return []FieldError{decodeError(err)}
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return []FieldError{{Field: bodyField, Message: "must contain a single JSON object"}}
+	}
+
+	return Struct(obj)
+}
+
+// Struct проверяет теги binding у уже заполненной структуры.
+func Struct(obj interface{}) []FieldError {
+	err := binding.Validator.ValidateStruct(obj)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return []FieldError{{Field: bodyField, Message: err.Error()}}
+	}
+
+	errs := make([]FieldError, 0, len(validationErrs))
+	for _, fe := range validationErrs {
+		errs = append(errs, FieldError{Field: fieldPath(fe), Message: message(fe)})
+	}
+	return errs
+}
+
+func decodeError(err error) FieldError {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, io.EOF):
+		return FieldError{Field: bodyField, Message: "is required"}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return FieldError{Field: bodyField, Message: "must be valid JSON"}
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return FieldError{Field: bodyField, Message: "must be a JSON object"}
+		}
+		return FieldError{Field: typeErr.Field, Message: "must be " + jsonType(typeErr.Type)}
+	}
+
+	// У encoding/json нет отдельного типа ошибки для неизвестного поля.
+	if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return FieldError{Field: strings.Trim(name, `"`), Message: "is not allowed"}
+	}
+	return FieldError{Field: bodyField, Message: "must be valid JSON"}
+}
+
+// fieldPath убирает имя структуры из пути: DepositRequest.amount -> amount.
+func fieldPath(fe validator.FieldError) string {
+	_, path, found := strings.Cut(fe.Namespace(), ".")
+	if !found {
+		return fe.Field()
+	}
+	return path
+}
+
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "required_without":
+		return fmt.Sprintf("is required unless %s is set", snakeCase(fe.Param()))
+	case "currency":
+		return "must be one of USD, RUB, EUR"
+	case "money":
+		return fmt.Sprintf("must be a positive amount up to %.0f with at most 2 decimal places", MaxAmount)
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters long", fe.Param())
+		}
+		if fe.Kind() == reflect.Slice {
+			if fe.Param() == "1" {
+				return "must not be empty"
+			}
+			return fmt.Sprintf("must have at least %s items", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters long", fe.Param())
+		}
+		if fe.Kind() == reflect.Slice {
+			return fmt.Sprintf("must have at most %s items", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	}
+	return "is invalid (" + fe.Tag() + ")"
+}
+
+// snakeCase переводит имя поля структуры из параметра тега в имя поля JSON:
+// RecoveryCode -> recovery_code.
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Ptr:
+		return jsonType(t.Elem())
+	}
+	return "an object"
+}
@@ -0,0 +1,138 @@
+package validation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type testRequest struct {
+	Amount       float64  `json:"amount" binding:"required,money"`
+	Currency     string   `json:"currency" binding:"required,currency"`
+	Email        string   `json:"email" binding:"omitempty,email"`
+	Password     string   `json:"password" binding:"omitempty,min=8,max=16"`
+	Code         string   `json:"code" binding:"required_without=RecoveryCode"`
+	RecoveryCode string   `json:"recovery_code"`
+	Scopes       []string `json:"scopes" binding:"omitempty,min=1,max=2,dive,oneof=read write"`
+	Limit        int      `json:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+func bind(t *testing.T, body string) []FieldError {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+
+	var req testRequest
+	return BindJSON(c, &req)
+}
+
+func TestBindJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []FieldError
+	}{
+		{
+			name: "valid",
+			body: `{"amount": 10.5, "currency": "USD", "code": "123456"}`,
+		},
+		{
+			name: "empty body",
+			body: ``,
+			want: []FieldError{{"body", "is required"}},
+		},
+		{
+			name: "malformed json",
+			body: `{"amount": `,
+			want: []FieldError{{"body", "must be valid JSON"}},
+		},
+		{
+			name: "not an object",
+			body: `[1, 2]`,
+			want: []FieldError{{"body", "must be a JSON object"}},
+		},
+		{
+			name: "trailing data",
+			body: `{"amount": 1, "currency": "USD", "code": "1"} {}`,
+			want: []FieldError{{"body", "must contain a single JSON object"}},
+		},
+		{
+			name: "unknown field",
+			body: `{"amount": 1, "currency": "USD", "code": "1", "admin": true}`,
+			want: []FieldError{{"admin", "is not allowed"}},
+		},
+		{
+			name: "wrong type",
+			body: `{"amount": "ten", "currency": "USD", "code": "1"}`,
+			want: []FieldError{{"amount", "must be a number"}},
+		},
+		{
+			name: "missing fields",
+			body: `{}`,
+			want: []FieldError{
+				{"amount", "is required"},
+				{"currency", "is required"},
+				{"code", "is required unless recovery_code is set"},
+			},
+		},
+		{
+			name: "custom tags",
+			body: `{"amount": 0.001, "currency": "GBP", "recovery_code": "abc"}`,
+			want: []FieldError{
+				{"amount", "must be a positive amount up to 1000000000000 with at most 2 decimal places"},
+				{"currency", "must be one of USD, RUB, EUR"},
+			},
+		},
+		{
+			name: "length and range",
+			body: `{"amount": 1, "currency": "RUB", "code": "1", "email": "nope", "password": "short", "limit": 500}`,
+			want: []FieldError{
+				{"email", "must be a valid email address"},
+				{"password", "must be at least 8 characters long"},
+				{"limit", "must be at most 100"},
+			},
+		},
+		{
+			name: "slice items",
+			body: `{"amount": 1, "currency": "EUR", "code": "1", "scopes": ["read", "admin"]}`,
+			want: []FieldError{{"scopes[1]", "must be one of read, write"}},
+		},
+		{
+			name: "slice length",
+			body: `{"amount": 1, "currency": "EUR", "code": "1", "scopes": []}`,
+			want: []FieldError{{"scopes", "must not be empty"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bind(t, tt.body); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BindJSON(%s) = %v, want %v", tt.body, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsMoney(t *testing.T) {
+	tests := []struct {
+		amount float64
+		ok     bool
+	}{
+		{0.01, true},
+		{19.99, true},
+		{MaxAmount, true},
+		{0, false},
+		{-1, false},
+		{0.005, false},
+		{MaxAmount + 1, false},
+	}
+	for _, tt := range tests {
+		if got := IsMoney(tt.amount); got != tt.ok {
+			t.Errorf("IsMoney(%v) = %v, want %v", tt.amount, got, tt.ok)
+		}
+	}
+}
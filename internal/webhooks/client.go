@@ -0,0 +1,63 @@
+package webhooks
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/config"
+)
+
+// deniedPrefixes — служебные сети, которые не покрывают проверки net.IP:
+// CGNAT (RFC 6598), внутри которой у провайдеров бывают свои сервисы, и
+// «эта сеть» 0.0.0.0/8, которую Linux считает локальной.
+var deniedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("0.0.0.0/8"),
+}
+
+// newClient создаёт HTTP-клиент для доставки. Редиректы не выполняются:
+// ответ 3xx считается ошибкой, иначе адрес из Location обходил бы проверку
+// сетей.
+func newClient(cfg config.WebhooksConfig) *http.Client {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivateTargets {
+		dialer.Control = denyPrivateAddress
+	}
+
+	return &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: cfg.Timeout,
+			MaxIdleConnsPerHost: 2,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// denyPrivateAddress запрещает соединения с локальными, частными и
+// служебными адресами. Проверяется адрес, к которому идёт соединение после
+// разрешения имени, так что подмена DNS её не обходит.
+func denyPrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("webhook target %s is in a private network", host)
+	}
+	addr, _ := netip.AddrFromSlice(ip)
+	for _, prefix := range deniedPrefixes {
+		if prefix.Contains(addr.Unmap()) {
+			return fmt.Errorf("webhook target %s is in a private network", host)
+		}
+	}
+	return nil
+}
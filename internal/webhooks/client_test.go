@@ -0,0 +1,35 @@
+package webhooks
+
+import "testing"
+
+func TestDenyPrivateAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		denied  bool
+	}{
+		{"93.184.216.34:443", false},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", false},
+		{"100.63.255.255:443", false},
+		{"100.128.0.0:443", false},
+		{"127.0.0.1:80", true},
+		{"[::1]:80", true},
+		{"10.1.2.3:443", true},
+		{"172.16.0.1:443", true},
+		{"192.168.1.1:443", true},
+		{"169.254.169.254:80", true},
+		{"0.0.0.0:80", true},
+		{"0.1.2.3:80", true},
+		{"100.64.0.1:443", true},
+		{"100.127.255.254:443", true},
+		{"[::ffff:100.64.0.1]:443", true},
+		{"[fd00::1]:443", true},
+		{"[fe80::1]:443", true},
+		{"224.0.0.1:443", true},
+	}
+	for _, tt := range tests {
+		err := denyPrivateAddress("tcp", tt.address, nil)
+		if (err != nil) != tt.denied {
+			t.Errorf("denyPrivateAddress(%s) = %v, want denied %v", tt.address, err, tt.denied)
+		}
+	}
+}
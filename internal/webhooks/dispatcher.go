@@ -0,0 +1,191 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/config"
+	"github.com/Krchnk/gw-currency-wallet/internal/metrics"
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+	"github.com/Krchnk/gw-currency-wallet/internal/totp"
+	"github.com/sirupsen/logrus"
+)
+
+// maxErrorLength ограничивает текст ошибки, который сохраняется в доставке.
+const maxErrorLength = 500
+
+// Store — очередь доставок, её реализует postgres.Storage.
+type Store interface {
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]storages.WebhookJob, error)
+	CompleteWebhookDelivery(ctx context.Context, deliveryID int64, attempt storages.DeliveryAttempt) error
+	RetryWebhookDelivery(ctx context.Context, deliveryID int64, attempt storages.DeliveryAttempt, delay time.Duration) error
+	DeadLetterWebhookDelivery(ctx context.Context, deliveryID int64, attempt storages.DeliveryAttempt) error
+}
+
+// Dispatcher забирает из очереди доставки, срок которых наступил, и
+// отправляет их. Доставка «хотя бы один раз»: получатель отбрасывает
+// повторы по X-Webhook-ID.
+type Dispatcher struct {
+	store  Store
+	cfg    config.WebhooksConfig
+	cipher *totp.Cipher
+	client *http.Client
+	logger *logrus.Logger
+}
+
+func NewDispatcher(store Store, cfg config.WebhooksConfig, cipher *totp.Cipher, logger *logrus.Logger) *Dispatcher {
+	return &Dispatcher{
+		store:  store,
+		cfg:    cfg,
+		cipher: cipher,
+		client: newClient(cfg),
+		logger: logger,
+	}
+}
+
+// Run опрашивает очередь раз в PollInterval до отмены ctx. Начатые
+// доставки завершаются: они ограничены Timeout и не зависят от ctx.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.deliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverDue отправляет накопившиеся доставки пачками по BatchSize.
+func (d *Dispatcher) deliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		// Запас сверх Timeout — на запись результата в базу.
+		jobs, err := d.store.ClaimWebhookDeliveries(ctx, d.cfg.BatchSize, d.cfg.Timeout+time.Minute)
+		if err != nil {
+			if ctx.Err() == nil {
+				d.logger.WithError(err).Error("failed to claim webhook deliveries")
+			}
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, job := range jobs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				d.deliver(job)
+			}()
+		}
+		wg.Wait()
+
+		if len(jobs) < d.cfg.BatchSize {
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(job storages.WebhookJob) {
+	delivery := job.Delivery
+	attempt := d.send(job)
+
+	ctx := context.Background()
+	log := d.logger.WithFields(logrus.Fields{
+		"delivery_id": delivery.ID,
+		"webhook_id":  delivery.EndpointID,
+		"event_id":    delivery.EventID,
+		"event_type":  delivery.EventType,
+		"attempt":     delivery.Attempts,
+		"status_code": attempt.StatusCode,
+	})
+
+	var err error
+	switch {
+	case attempt.Error == "":
+		err = d.store.CompleteWebhookDelivery(ctx, delivery.ID, attempt)
+		metrics.ObserveWebhookDelivery(delivery.EventType, metrics.WebhookDelivered)
+		log.Info("webhook delivered")
+	case delivery.Attempts >= d.cfg.MaxAttempts:
+		err = d.store.DeadLetterWebhookDelivery(ctx, delivery.ID, attempt)
+		metrics.ObserveWebhookDelivery(delivery.EventType, metrics.WebhookDead)
+		log.WithField("error", attempt.Error).Error("webhook delivery failed, moved to dead letter")
+	default:
+		delay := Backoff(delivery.Attempts, d.cfg.BackoffBase, d.cfg.BackoffMax)
+		err = d.store.RetryWebhookDelivery(ctx, delivery.ID, attempt, delay)
+		metrics.ObserveWebhookDelivery(delivery.EventType, metrics.WebhookRetry)
+		log.WithFields(logrus.Fields{
+			"error":    attempt.Error,
+			"retry_in": delay,
+		}).Warn("webhook delivery failed, will retry")
+	}
+	if err != nil {
+		// Доставка снова станет доступной после истечения аренды.
+		log.WithError(err).Error("failed to save webhook delivery result")
+	}
+}
+
+// send делает одну попытку доставки. Успех — любой ответ 2xx.
+func (d *Dispatcher) send(job storages.WebhookJob) storages.DeliveryAttempt {
+	secret, err := d.cipher.Decrypt(job.EncryptedSecret)
+	if err != nil {
+		return failed(0, fmt.Errorf("decrypt secret: %w", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.cfg.Timeout)
+	defer cancel()
+
+	body := []byte(job.Delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.URL, bytes.NewReader(body))
+	if err != nil {
+		return failed(0, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "gw-currency-wallet-webhooks/1")
+	req.Header.Set(HeaderEventID, job.Delivery.EventID)
+	req.Header.Set(HeaderEvent, job.Delivery.EventType)
+	req.Header.Set(HeaderSignature, Sign(secret, time.Now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return failed(0, err)
+	}
+	defer resp.Body.Close()
+	// Тело не нужно, но дочитываем его, чтобы соединение вернулось в пул.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return failed(resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status))
+	}
+	return storages.DeliveryAttempt{StatusCode: resp.StatusCode}
+}
+
+func failed(statusCode int, err error) storages.DeliveryAttempt {
+	msg := err.Error()
+	if len(msg) > maxErrorLength {
+		msg = msg[:maxErrorLength]
+	}
+	return storages.DeliveryAttempt{StatusCode: statusCode, Error: msg}
+}
+
+// Backoff возвращает паузу после attempt-й неудачной попытки: base,
+// 2*base, 4*base и так далее, но не больше max. Случайная добавка до 10%
+// разносит повторы доставок, упавших одновременно.
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	delay += rand.N(delay/10 + 1)
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
@@ -0,0 +1,31 @@
+package webhooks
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffBounds(t *testing.T) {
+	base, max := 30*time.Second, 6*time.Hour
+	tests := []struct {
+		attempt int
+		delay   time.Duration // пауза без случайной добавки
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{8, 64 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, max},
+		{50, max},
+	}
+	for _, tt := range tests {
+		upper := min(tt.delay+tt.delay/10, max)
+		for range 100 {
+			got := Backoff(tt.attempt, base, max)
+			if got < tt.delay || got > upper {
+				t.Fatalf("Backoff(%d) = %v, want within [%v, %v]", tt.attempt, got, tt.delay, upper)
+			}
+		}
+	}
+}
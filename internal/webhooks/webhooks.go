@@ -0,0 +1,82 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Krchnk/gw-currency-wallet/internal/storages"
+)
+
+// Заголовки запроса вебхука
+const (
+	HeaderEventID   = "X-Webhook-ID"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Events — события, на которые можно подписаться.
+var Events = []string{
+	storages.EventDepositCompleted,
+	storages.EventWithdrawalCompleted,
+	storages.EventExchangeCompleted,
+	storages.EventTransferReceived,
+}
+
+func KnownEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSecret генерирует секрет для подписи. Он показывается пользователю
+// один раз, при создании вебхука.
+func NewSecret() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// Sign возвращает значение заголовка X-Webhook-Signature:
+// t=<unix-время>,v1=<hex HMAC-SHA256 от "<t>.<тело>">. Время входит в
+// подпись, чтобы получатель мог отбросить старые перехваченные запросы.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t + "."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidateURL проверяет адрес вебхука. Адреса во внутренних сетях
+// отсекаются позже, при соединении, потому что имя может разрешиться
+// в другой адрес.
+func ValidateURL(raw string, requireHTTPS bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return errors.New("must be an absolute URL")
+	}
+	switch {
+	case u.Scheme == "https":
+	case u.Scheme == "http" && !requireHTTPS:
+	case u.Scheme == "http":
+		return errors.New("must use https")
+	default:
+		return errors.New("must use http or https")
+	}
+	if u.User != nil {
+		return errors.New("must not contain credentials")
+	}
+	return nil
+}
@@ -0,0 +1,2 @@
+-- Версия токенов пользователя: смена пароля увеличивает её и отзывает выданные JWT
+ALTER TABLE users ADD COLUMN IF NOT EXISTS token_version INT NOT NULL DEFAULT 0;
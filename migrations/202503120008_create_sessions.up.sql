@@ -0,0 +1,14 @@
+-- Сессии, привязанные к выданным JWT (claim sid)
+CREATE TABLE IF NOT EXISTS sessions (
+    id VARCHAR(32) PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device VARCHAR(100) NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+    );
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
@@ -0,0 +1,16 @@
+-- Журнал операций по кошельку: пополнения, выводы и обмены
+CREATE TABLE IF NOT EXISTS transactions (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    type VARCHAR(16) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    amount DOUBLE PRECISION NOT NULL,
+    to_currency VARCHAR(3),
+    to_amount DOUBLE PRECISION,
+    rate DOUBLE PRECISION,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (type IN ('deposit', 'withdraw', 'exchange')),
+    CHECK (amount > 0)
+    );
+
+CREATE INDEX IF NOT EXISTS idx_transactions_user_id ON transactions(user_id, id DESC);
@@ -0,0 +1,2 @@
+-- Комиссия за операцию в валюте currency
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fee DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (fee >= 0);
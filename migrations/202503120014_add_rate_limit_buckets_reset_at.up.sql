@@ -0,0 +1,3 @@
+-- Момент, когда корзина полностью восстановится; после него запись не нужна
+ALTER TABLE rate_limit_buckets ADD COLUMN IF NOT EXISTS reset_at TIMESTAMP NOT NULL DEFAULT NOW();
+CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_reset_at ON rate_limit_buckets (reset_at);
@@ -0,0 +1,35 @@
+ALTER TABLE sessions
+    ALTER COLUMN created_at TYPE TIMESTAMP,
+    ALTER COLUMN last_seen_at TYPE TIMESTAMP,
+    ALTER COLUMN expires_at TYPE TIMESTAMP,
+    ALTER COLUMN revoked_at TYPE TIMESTAMP;
+
+ALTER TABLE api_keys
+    ALTER COLUMN expires_at TYPE TIMESTAMP,
+    ALTER COLUMN last_used_at TYPE TIMESTAMP,
+    ALTER COLUMN revoked_at TYPE TIMESTAMP,
+    ALTER COLUMN created_at TYPE TIMESTAMP;
+
+ALTER TABLE user_tokens
+    ALTER COLUMN expires_at TYPE TIMESTAMP,
+    ALTER COLUMN used_at TYPE TIMESTAMP,
+    ALTER COLUMN created_at TYPE TIMESTAMP;
+
+ALTER TABLE user_recovery_codes
+    ALTER COLUMN used_at TYPE TIMESTAMP,
+    ALTER COLUMN created_at TYPE TIMESTAMP;
+
+ALTER TABLE user_totp
+    ALTER COLUMN confirmed_at TYPE TIMESTAMP,
+    ALTER COLUMN created_at TYPE TIMESTAMP;
+
+ALTER TABLE rate_limit_buckets
+    ALTER COLUMN updated_at TYPE TIMESTAMP,
+    ALTER COLUMN reset_at TYPE TIMESTAMP;
+
+ALTER TABLE exchange_rates
+    ALTER COLUMN updated_at TYPE TIMESTAMP;
+
+ALTER TABLE users
+    ALTER COLUMN created_at TYPE TIMESTAMP,
+    ALTER COLUMN email_verified_at TYPE TIMESTAMP;
\ No newline at end of file
@@ -0,0 +1,38 @@
+-- Все отметки времени храним с часовым поясом: сроки сравниваются с NOW() и отдаются клиентам,
+-- и смена часового пояса сервера не должна их сдвигать.
+-- Старые значения записаны по часам базы и переводятся в часовом поясе сессии миграции.
+ALTER TABLE users
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN email_verified_at TYPE TIMESTAMPTZ;
+
+ALTER TABLE exchange_rates
+    ALTER COLUMN updated_at TYPE TIMESTAMPTZ;
+
+ALTER TABLE rate_limit_buckets
+    ALTER COLUMN updated_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN reset_at TYPE TIMESTAMPTZ;
+
+ALTER TABLE user_totp
+    ALTER COLUMN confirmed_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+
+ALTER TABLE user_recovery_codes
+    ALTER COLUMN used_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+
+ALTER TABLE user_tokens
+    ALTER COLUMN expires_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN used_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+
+ALTER TABLE api_keys
+    ALTER COLUMN expires_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN last_used_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN revoked_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+
+ALTER TABLE sessions
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN last_seen_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN expires_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN revoked_at TYPE TIMESTAMPTZ;
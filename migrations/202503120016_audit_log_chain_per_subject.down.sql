@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_audit_log_chain_key;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS chain_key;
\ No newline at end of file
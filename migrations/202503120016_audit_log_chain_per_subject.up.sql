@@ -0,0 +1,4 @@
+-- Цепочка журнала аудита по пользователю (subject_user_id, 0 - события без пользователя).
+-- Старые записи остаются одной общей цепочкой SHA-256 с chain_key IS NULL
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS chain_key INT;
+CREATE INDEX IF NOT EXISTS idx_audit_log_chain_key ON audit_log(chain_key, id);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_outbox_unpublished_key;
+DROP INDEX IF EXISTS idx_outbox_unpublished;
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON outbox(id) WHERE published_at IS NULL;
+ALTER TABLE outbox DROP COLUMN IF EXISTS dead_at;
+ALTER TABLE outbox DROP COLUMN IF EXISTS next_attempt_at;
\ No newline at end of file
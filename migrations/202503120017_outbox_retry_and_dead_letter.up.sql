@@ -0,0 +1,7 @@
+-- Повтор неудачной публикации не раньше next_attempt_at; dead_at - событие в dead letter
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ;
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS dead_at TIMESTAMPTZ;
+
+DROP INDEX IF EXISTS idx_outbox_unpublished;
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON outbox(id) WHERE published_at IS NULL AND dead_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished_key ON outbox(aggregate_id, id) WHERE published_at IS NULL AND dead_at IS NULL;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS mfa_challenges;
\ No newline at end of file